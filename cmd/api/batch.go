@@ -0,0 +1,85 @@
+package main
+
+import (
+	"greenlight.311102.xyz/internal/data"
+	"greenlight.311102.xyz/internal/validator"
+	"net/http"
+)
+
+// maxBatchIDs 是一次批量读取最多可以请求的影片数量，与列表的最大 page_size 相同。
+const maxBatchIDs = 100
+
+// batchGetMoviesInput 是 POST /v1/movies/batch-get 的请求体。
+type batchGetMoviesInput struct {
+	IDs []int64 `json:"ids"`
+}
+
+// batchGetMoviesHandler 处理 POST /v1/movies/batch-get，请求体为 {"ids": [1, 2, 3]}，响应与 GET /v1/movies?ids=1,2,3 相同。
+// 当 ID 太多，放在 URL 中过长时可以使用这个接口。
+func (app *application) batchGetMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	var input batchGetMoviesInput
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	for _, id := range input.IDs {
+		v.Check(id > 0, "ids", "must only contain positive integer values")
+	}
+
+	app.writeMovieBatch(w, r, input.IDs, v)
+}
+
+// writeMovieBatch() 在一次查询中读取 ids 中的影片，并按照 ids 的顺序返回。找不到的影片不会导致整个请求失败，
+// 而是在 not_found 中列出。与影片详情一样支持 fields、include 和 run_time_format 查询参数。
+func (app *application) writeMovieBatch(w http.ResponseWriter, r *http.Request, ids []int64, v *validator.Validator) {
+	qs := r.URL.Query()
+
+	fields := app.readCSV(qs, "fields", []string{})
+	include := app.readCSV(qs, "include", []string{})
+	runTimeFormat := app.readRunTimeFormat(r, v)
+
+	v.Check(len(ids) > 0, "ids", "must contain at least 1 id")
+	v.Check(len(ids) <= maxBatchIDs, "ids", "must not contain more than 100 ids")
+	v.Check(validator.Unique(ids), "ids", "must not contain duplicate values")
+	data.ValidateFields(v, fields, movieFieldSafeList)
+	if validateInclude(v, include); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	movies, err := app.models.Movies.GetMany(ids, fields...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	byID := make(map[int64]*data.Movie, len(movies))
+	for _, movie := range movies {
+		byID[movie.ID] = movie
+	}
+
+	found := make([]*data.Movie, 0, len(movies))
+	notFound := []int64{}
+	for _, id := range ids {
+		if movie, ok := byID[id]; ok {
+			found = append(found, movie)
+		} else {
+			notFound = append(notFound, id)
+		}
+	}
+
+	resources, err := app.shapeMovies(found, fields, include, runTimeFormat)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"movies": resources, "not_found": notFound}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 )
@@ -17,7 +18,7 @@ func (app *application) logError(r *http.Request, err error) {
 // errorResponse() 方法是一个通用辅助方法，用于向客户端发送带有给定状态代码的 JSON 格式错误消息。请注意，我们为消息参数使用的是任意类型，而不仅仅是字符串类型，因为这让我们可以更灵活地处理响应中包含的值。
 func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, message any) {
 	env := envelope{"error": message}
-	err := app.writeJSON(w, status, env, nil)
+	err := app.writeResponse(w, r, status, env, nil)
 	if err != nil {
 		app.logError(r, err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -89,3 +90,44 @@ func (app *application) notPermittedResponse(w http.ResponseWriter, r *http.Requ
 	message := "your user account doesn't have the necessary permissions to access this resource"
 	app.errorResponse(w, r, http.StatusForbidden, message)
 }
+
+func (app *application) unsupportedMediaTypeResponse(w http.ResponseWriter, r *http.Request) {
+	message := fmt.Sprintf("the %q content type is not supported for this resource", r.Header.Get("Content-Type"))
+	app.errorResponse(w, r, http.StatusUnsupportedMediaType, message)
+}
+
+func (app *application) preconditionFailedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the resource has been modified since you last fetched it, please fetch it again and retry"
+	app.errorResponse(w, r, http.StatusPreconditionFailed, message)
+}
+
+func (app *application) patchTestFailedResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.errorResponse(w, r, http.StatusConflict, err.Error())
+}
+
+// duplicateMovieResponse() 在新建的影片可能与已有影片重复时发送 409 Conflict 响应，candidates 是可能重复的影片 ID。
+func (app *application) duplicateMovieResponse(w http.ResponseWriter, r *http.Request, candidates []int64) {
+	message := "a movie with the same title and year may already exist, use allow_duplicate=true to create it anyway"
+	err := app.writeResponse(w, r, http.StatusConflict, envelope{"error": message, "candidates": candidates}, nil)
+	if err != nil {
+		app.logError(r, err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// notAcceptableResponse() 在无法以 Accept 标头中的任何媒体类型表示响应时发送 406 Not Acceptable。
+// 这个响应本身绕过内容协商，总是使用 JSON 发送。
+func (app *application) notAcceptableResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the requested resource is not available in any of the media types listed in the Accept header"
+	js, err := json.Marshal(envelope{"error": message})
+	if err != nil {
+		app.logError(r, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	addVary(w.Header(), "Accept")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNotAcceptable)
+	w.Write(append(js, '\n'))
+}
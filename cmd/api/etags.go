@@ -0,0 +1,182 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"greenlight.311102.xyz/internal/data"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// movieETag() 根据影片的版本号和评分汇总生成强 ETag，例如 "3-12-8.25"（版本号、评分数量、平均分）。每次更新影片时版本号都会递增，
+// 但评分和评论不会改变影片的版本号，而评分汇总是影片表示形式的一部分，因此也要包含在 ETag 中。
+func movieETag(movie *data.Movie) string {
+	var rating data.RatingSummary
+	if movie.Rating != nil {
+		rating = *movie.Rating
+	}
+	return strconv.Quote(fmt.Sprintf("%d-%d-%s", movie.Version, rating.Count, strconv.FormatFloat(rating.Average, 'f', -1, 64)))
+}
+
+// moviesETag() 为影片列表生成弱 ETag。它由列表中每部影片的 id 和 ETag、分页元数据以及分面统计（如果有）计算而来，
+// 任何一部影片被修改、评分、增加或删除都会导致 ETag 发生变化。fmt 打印 map 时会对键排序，所以结果是稳定的。
+func moviesETag(movies []*data.Movie, metadata data.Metadata, facets data.Facets) string {
+	h := sha256.New()
+	for _, movie := range movies {
+		fmt.Fprintf(h, "%d:%s,", movie.ID, movieETag(movie))
+	}
+	fmt.Fprintf(h, "%+v", metadata)
+	if facets != nil {
+		fmt.Fprintf(h, "%+v", facets)
+	}
+
+	return `W/"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// formatETag() 在 ETag 中加入 run_time 的输出格式。同一个版本的影片以不同格式输出时是不同的表示形式，强 ETag 不能相同，
+// 尤其是格式来自 Accept 标头时，缓存只能依靠 ETag 区分它们。默认格式的 ETag 保持不变。
+func formatETag(etag, runTimeFormat string) string {
+	if runTimeFormat == "" || runTimeFormat == data.RunTimeMins {
+		return etag
+	}
+	return appendETag(etag, runTimeFormat)
+}
+
+// appendETag() 在 ETag 的引号内追加一段后缀，例如 "3-12-8.25" 追加 hours 得到 "3-12-8.25-hours"。弱 ETag 的 W/ 前缀保持不变。
+func appendETag(etag, suffix string) string {
+	return strings.TrimSuffix(etag, `"`) + "-" + suffix + `"`
+}
+
+// movieETagMatches() 检查 If-Match 标头是否与影片当前的版本相匹配。影片的强 ETag 总是以版本号开头，后面的评分汇总、输出格式等部分
+// 只影响表示形式而不影响影片本身。如果直接比较完整的 ETag，别人给影片评个分就会让客户端的修改请求返回 412，
+// 所以这里先把每个候选 ETag 截成只包含版本号的 ETag（例如 "3-12-8.25-hours" 截成 "3"），再与影片当前版本的 ETag 进行强比较。
+func movieETagMatches(header string, movie *data.Movie) bool {
+	etag := strconv.Quote(strconv.FormatInt(int64(movie.Version), 10))
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+
+		if candidate == "*" {
+			return true
+		}
+
+		if version, _, found := strings.Cut(candidate, "-"); found {
+			candidate = version + `"`
+		}
+		if etagMatches(candidate, etag, false) {
+			return true
+		}
+	}
+	return false
+}
+
+// contentETag() 根据响应内容生成弱 ETag。嵌入的关联资源（例如 include=reviews 中的影评）发生变化时影片的版本号不会变化，
+// 因此这类表示形式只能根据实际的内容计算 ETag。
+func contentETag(v any) (string, error) {
+	hash, err := contentHash(v)
+	if err != nil {
+		return "", err
+	}
+	return `W/"` + hash + `"`, nil
+}
+
+// contentHash() 返回响应内容的 JSON 编码的 SHA-256 摘要（前 16 个字节的十六进制形式）。
+func contentHash(v any) (string, error) {
+	js, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(js)
+	return hex.EncodeToString(sum[:16]), nil
+}
+
+// etagMatches() 检查 If-Match 或 If-None-Match 标头中的 ETag 列表是否包含给定的 ETag。
+// "*" 匹配任意 ETag。weak 为 true 时使用弱比较（忽略 W/ 前缀），这是 If-None-Match 的要求；If-Match 则必须使用强比较。
+func etagMatches(header, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+
+		if candidate == "*" {
+			return true
+		}
+
+		if weak {
+			if strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+			continue
+		}
+
+		// 强比较时，任何一方是弱 ETag 都不算匹配。
+		if !strings.HasPrefix(candidate, "W/") && !strings.HasPrefix(etag, "W/") && candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// representationETag() 在 ETag 中加入协商得到的媒体类型和 pretty 参数。同一部影片的 JSON、缩进的 JSON、XML 等是不同的表示形式，
+// 强 ETag 不能相同，否则 XML 客户端带着 JSON 的 ETag 发送 If-None-Match 时会得到 304。
+// 与 formatETag() 一样，默认表示形式（不缩进的 JSON）的 ETag 保持不变。
+func representationETag(etag, mediaType string, pretty bool) string {
+	if mediaType == "application/json" {
+		if pretty {
+			return appendETag(etag, "pretty")
+		}
+		return etag
+	}
+	return appendETag(etag, mediaType)
+}
+
+// notModified() 设置 ETag 响应标头，如果请求的 If-None-Match 标头与之匹配，则发送 304 Not Modified 响应并返回 true，
+// 此时处理程序不应再写入任何内容。env 是完整响应将要发送的内容，用来协商响应的媒体类型，从而得到该表示形式的 ETag。
+func (app *application) notModified(w http.ResponseWriter, r *http.Request, etag string, env envelope) bool {
+	if _, mediaType := negotiate(r.Header.Get("Accept"), env); mediaType != "" {
+		etag = representationETag(etag, mediaType, readPretty(r))
+	}
+
+	w.Header().Set("ETag", etag)
+	// 304 响应也要带上完整响应会发送的 Vary 标头，否则缓存可能会用它更新另一种表示形式。
+	addVary(w.Header(), "Accept")
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" && etagMatches(inm, etag, true) {
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+// checkMoviePreconditions() 在修改影片之前检查请求中的前置条件。标准的 If-Match 标头不匹配时返回 412 Precondition Failed；
+// 为了兼容旧的客户端，仍然支持自定义的 X-Expected-Version 标头（不匹配时返回 409 Conflict）。
+// 如果前置条件不满足，它会发送响应并返回 false。
+func (app *application) checkMoviePreconditions(w http.ResponseWriter, r *http.Request, movie *data.Movie) bool {
+	if im := r.Header.Get("If-Match"); im != "" && !movieETagMatches(im, movie) {
+		app.preconditionFailedResponse(w, r)
+		return false
+	}
+
+	// 如果请求包含 X-Expected-Version 标头，则要验证数据库中的电影版本是否与标头中指定的预期版本一致。
+	if r.Header.Get("X-Expected-Version") != "" {
+		// FormatInt 返回 i 以给定基数表示的字符串，2 <= 基数 <= 36。对于大于等于 10 的数字值，结果使用小写字母 "a "至 "z "表示。
+		if strconv.FormatInt(int64(movie.Version), 32) != r.Header.Get("X-Expected-Version") {
+			app.editConflictResponse(w, r)
+			return false
+		}
+	}
+
+	return true
+}
+
+// movieEditConflictResponse() 在 Update() 或 Delete() 返回 ErrEditConflict 时使用。如果客户端使用了 If-Match，
+// 说明在检查前置条件之后影片又被修改了，此时应当返回 412 而不是 409。
+func (app *application) movieEditConflictResponse(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("If-Match") != "" {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+	app.editConflictResponse(w, r)
+}
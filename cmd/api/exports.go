@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"greenlight.311102.xyz/internal/data"
+	"greenlight.311102.xyz/internal/validator"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exportFlushInterval 是导出时每写入多少行就把缓冲的数据发送给客户端一次。
+const exportFlushInterval = 100
+
+// exportFormats 将 ?format= 参数的值映射到对应的 Content-Type。
+var exportFormats = map[string]string{
+	"csv":    "text/csv",
+	"ndjson": "application/x-ndjson",
+	"json":   "application/json",
+}
+
+// movieWriter 将影片逐条写入响应，每种导出格式各有一个实现。
+type movieWriter interface {
+	begin() error
+	write(movie *data.Movie) error
+	end() error
+}
+
+func (app *application) exportMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Format        string
+		RunTimeFormat string
+		data.MovieFilters
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.MovieFilters = app.readMovieFilters(qs, v)
+	input.Format = app.readString(qs, "format", exportFormatFromAccept(r.Header.Get("Accept")))
+	input.RunTimeFormat = app.readRunTimeFormat(r, v)
+	input.Filters.Sort = app.readString(qs, "sort", "id")
+	input.Filters.SortSafeList = movieSortSafeList
+
+	genres, err := app.models.Genres.Lookup()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// 导出不分页，所以这里只需要验证过滤条件、排序参数和导出格式。
+	data.ValidateMovieFilters(v, &input.MovieFilters, genres)
+	v.Check(validator.PermittedValue(input.Filters.Sort, input.Filters.SortSafeList...), "sort", "invalid sort value")
+	if input.Filters.Sort == "-relevance" {
+		v.Check(input.MovieFilters.Title != "", "sort", "relevance sort requires a title search")
+	}
+	_, ok := exportFormats[input.Format]
+	v.Check(ok, "format", "must be one of csv, ndjson or json")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// 导出整个目录可能需要较长时间，因此单独为这个请求延长写入期限。
+	rc := http.NewResponseController(w)
+	err = rc.SetWriteDeadline(time.Now().Add(10 * time.Minute))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	var mw movieWriter
+	switch input.Format {
+	case "csv":
+		mw = &csvMovieWriter{w: csv.NewWriter(w)}
+	case "ndjson":
+		mw = &ndjsonMovieWriter{enc: json.NewEncoder(w), runTimeFormat: input.RunTimeFormat}
+	default:
+		mw = &jsonMovieWriter{w: w, runTimeFormat: input.RunTimeFormat}
+	}
+
+	// 导出格式和 run_time 格式都可能来自 Accept 标头。
+	addVary(w.Header(), "Accept")
+	w.Header().Set("Content-Type", exportFormats[input.Format])
+	w.Header().Set("Content-Disposition", "attachment; filename=movies."+input.Format)
+	w.WriteHeader(http.StatusOK)
+
+	// 一旦开始写入响应体，状态码就已经发送给了客户端，之后出现的错误只能记录到日志中。
+	// 此时响应体是不完整的（例如 JSON 数组没有闭合），客户端可以据此判断导出失败。
+	err = mw.begin()
+	if err != nil {
+		app.logError(r, err)
+		return
+	}
+
+	count := 0
+	err = app.models.Movies.Stream(input.MovieFilters, input.Filters, func(movie *data.Movie) error {
+		err := mw.write(movie)
+		if err != nil {
+			return err
+		}
+
+		count++
+		if count%exportFlushInterval == 0 {
+			return rc.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		app.logError(r, err)
+		return
+	}
+
+	err = mw.end()
+	if err != nil {
+		app.logError(r, err)
+	}
+}
+
+// exportFormatFromAccept() 根据 Accept 标头选择导出格式，如果没有匹配的媒体类型，则默认使用 JSON。
+func exportFormatFromAccept(accept string) string {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case "text/csv":
+			return "csv"
+		case "application/x-ndjson", "application/ndjson":
+			return "ndjson"
+		case "application/json":
+			return "json"
+		}
+	}
+	return "json"
+}
+
+type csvMovieWriter struct {
+	w *csv.Writer
+}
+
+func (cw *csvMovieWriter) begin() error {
+	return cw.w.Write([]string{"id", "title", "year", "run_time", "genres", "version"})
+}
+
+// CSV 中的 run_time 总是使用分钟数（不受 run_time_format 影响），genres 使用逗号连接，与导入接口接受的格式保持一致。
+func (cw *csvMovieWriter) write(movie *data.Movie) error {
+	err := cw.w.Write([]string{
+		strconv.FormatInt(movie.ID, 10),
+		movie.Title,
+		strconv.FormatInt(int64(movie.Year), 10),
+		strconv.FormatInt(int64(movie.RunTime), 10),
+		strings.Join(movie.Genres, ","),
+		strconv.FormatInt(int64(movie.Version), 10),
+	})
+	if err != nil {
+		return err
+	}
+	// csv.Writer 自带缓冲，这里把缓冲区交给下层的 ResponseWriter，真正发送由 Flush() 控制。
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+func (cw *csvMovieWriter) end() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+type ndjsonMovieWriter struct {
+	enc           *json.Encoder
+	runTimeFormat string
+}
+
+func (nw *ndjsonMovieWriter) begin() error {
+	return nil
+}
+
+// json.Encoder 的 Encode() 方法会在每个值后面追加换行符，正好符合 NDJSON 的格式。
+func (nw *ndjsonMovieWriter) write(movie *data.Movie) error {
+	if nw.runTimeFormat == data.RunTimeMins {
+		return nw.enc.Encode(movie)
+	}
+
+	raw, err := movieFields(movie, nw.runTimeFormat)
+	if err != nil {
+		return err
+	}
+	return nw.enc.Encode(raw)
+}
+
+func (nw *ndjsonMovieWriter) end() error {
+	return nil
+}
+
+type jsonMovieWriter struct {
+	w             io.Writer
+	runTimeFormat string
+	written       bool
+}
+
+func (jw *jsonMovieWriter) begin() error {
+	_, err := io.WriteString(jw.w, "[")
+	return err
+}
+
+func (jw *jsonMovieWriter) write(movie *data.Movie) error {
+	var resource any = movie
+	if jw.runTimeFormat != data.RunTimeMins {
+		raw, err := movieFields(movie, jw.runTimeFormat)
+		if err != nil {
+			return err
+		}
+		resource = raw
+	}
+
+	js, err := json.Marshal(resource)
+	if err != nil {
+		return err
+	}
+
+	if jw.written {
+		js = append([]byte(",\n"), js...)
+	} else {
+		js = append([]byte("\n"), js...)
+	}
+	jw.written = true
+
+	_, err = jw.w.Write(js)
+	return err
+}
+
+func (jw *jsonMovieWriter) end() error {
+	_, err := io.WriteString(jw.w, "\n]\n")
+	return err
+}
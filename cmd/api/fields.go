@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"greenlight.311102.xyz/internal/data"
+	"greenlight.311102.xyz/internal/validator"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// movieFieldSafeList 是 ?fields= 参数允许使用的影片字段，即 Movie 序列化为 JSON 后的字段名。
+var movieFieldSafeList = []string{"id", "title", "year", "run_time", "genres", "version", "highlight", "rating", "poster"}
+
+// movieIncludes 保存 ?include= 参数可以嵌入到影片中的关联资源，以及加载这些资源的函数。加载函数在一次查询中读取所有影片的关联资源，
+// 返回以影片 ID 为键的结果，这样影片列表和批量读取不会为每部影片各查询一次。
+// 新增关联资源时只需要在这里注册即可，影片详情和影片列表都会支持它。
+var movieIncludes = map[string]func(app *application, movieIDs []int64) (map[int64]any, error){
+	// 只嵌入最近的 20 个历史版本，完整的列表请使用 /v1/movies/:id/revisions。
+	"revisions": func(app *application, movieIDs []int64) (map[int64]any, error) {
+		revisions, err := app.models.MovieRevisions.GetLatestForMovies(movieIDs, 20)
+		return groupByMovie(movieIDs, revisions), err
+	},
+	// 只嵌入最新的 20 篇影评，完整的列表请使用 /v1/movies/:id/reviews。
+	"reviews": func(app *application, movieIDs []int64) (map[int64]any, error) {
+		reviews, err := app.models.Reviews.GetLatestForMovies(movieIDs, 20)
+		return groupByMovie(movieIDs, reviews), err
+	},
+	"credits": func(app *application, movieIDs []int64) (map[int64]any, error) {
+		credits, err := app.models.Credits.GetAllForMovies(movieIDs)
+		return groupByMovie(movieIDs, credits), err
+	},
+}
+
+// groupByMovie() 把按影片 ID 分组的关联资源转换为 movieIncludes 的返回值。没有关联资源的影片对应空的列表，而不是 null。
+func groupByMovie[T any](movieIDs []int64, groups map[int64][]T) map[int64]any {
+	related := make(map[int64]any, len(movieIDs))
+	for _, id := range movieIDs {
+		if groups[id] == nil {
+			related[id] = []T{}
+			continue
+		}
+		related[id] = groups[id]
+	}
+	return related
+}
+
+func validateInclude(v *validator.Validator, include []string) {
+	for _, name := range include {
+		_, ok := movieIncludes[name]
+		v.Check(ok, "include", "invalid include value: "+name)
+	}
+	v.Check(validator.Unique(include), "include", "must not contain duplicate values")
+}
+
+// readRunTimeFormat() 读取客户端希望的 run_time 输出格式。run_time_format 查询参数优先，其次是 Accept 标头中媒体类型的
+// run_time_format 参数，例如 "Accept: application/json; run_time_format=iso8601"。都没有提供时使用默认的 "<n> mins" 格式。
+func (app *application) readRunTimeFormat(r *http.Request, v *validator.Validator) string {
+	format := r.URL.Query().Get("run_time_format")
+	if format == "" {
+		for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+			_, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err == nil && params["run_time_format"] != "" {
+				format = params["run_time_format"]
+				break
+			}
+		}
+	}
+
+	if format == "" {
+		return data.RunTimeMins
+	}
+
+	v.Check(validator.PermittedValue(format, data.RunTimeFormats...), "run_time_format", "must be one of "+strings.Join(data.RunTimeFormats, ", "))
+	return format
+}
+
+// movieFields() 把影片序列化为字段名到 JSON 值的映射，并按照 runTimeFormat 改写 run_time 字段。
+func movieFields(movie *data.Movie, runTimeFormat string) (map[string]json.RawMessage, error) {
+	js, err := json.Marshal(movie)
+	if err != nil {
+		return nil, err
+	}
+
+	// 使用 json.RawMessage 保存字段值，这样序列化结果与 Movie 自身的 MarshalJSON（例如 run_time）完全相同。
+	var raw map[string]json.RawMessage
+
+	err = json.Unmarshal(js, &raw)
+	if err != nil {
+		return nil, err
+	}
+
+	// run_time 为 0 时会因为 omitempty 被省略，此时也不需要改写。
+	if _, ok := raw["run_time"]; ok && runTimeFormat != data.RunTimeMins {
+		raw["run_time"], err = json.Marshal(movie.RunTime.Format(runTimeFormat))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return raw, nil
+}
+
+// shapeMovie() 按照 fields、include 和 run_time 格式调整影片的表示形式：只保留请求的字段，嵌入请求的关联资源，并按请求的格式输出 run_time。
+// 这些参数都没有提供时原样返回影片，以保证响应与之前完全一致。
+func (app *application) shapeMovie(movie *data.Movie, fields, include []string, runTimeFormat string) (any, error) {
+	if len(fields) == 0 && len(include) == 0 && runTimeFormat == data.RunTimeMins {
+		return movie, nil
+	}
+
+	resources, err := app.shapeMovieResources([]*data.Movie{movie}, fields, include, runTimeFormat)
+	if err != nil {
+		return nil, err
+	}
+	return resources[0], nil
+}
+
+// shapeMovies() 与 shapeMovie() 相同，但每种关联资源只需要为整个列表查询一次。
+func (app *application) shapeMovies(movies []*data.Movie, fields, include []string, runTimeFormat string) (any, error) {
+	if len(fields) == 0 && len(include) == 0 && runTimeFormat == data.RunTimeMins {
+		return movies, nil
+	}
+
+	return app.shapeMovieResources(movies, fields, include, runTimeFormat)
+}
+
+// shapeMovieResources() 是 shapeMovie() 和 shapeMovies() 的共同实现。
+func (app *application) shapeMovieResources(movies []*data.Movie, fields, include []string, runTimeFormat string) ([]map[string]any, error) {
+	ids := make([]int64, len(movies))
+	for i, movie := range movies {
+		ids[i] = movie.ID
+	}
+
+	related := make(map[string]map[int64]any, len(include))
+	for _, name := range include {
+		values, err := movieIncludes[name](app, ids)
+		if err != nil {
+			return nil, err
+		}
+		related[name] = values
+	}
+
+	resources := make([]map[string]any, len(movies))
+	for i, movie := range movies {
+		raw, err := movieFields(movie, runTimeFormat)
+		if err != nil {
+			return nil, err
+		}
+
+		resource := make(map[string]any, len(raw)+len(include))
+		for key, value := range raw {
+			if len(fields) == 0 || slices.Contains(fields, key) {
+				resource[key] = value
+			}
+		}
+
+		for _, name := range include {
+			resource[name] = related[name][movie.ID]
+		}
+
+		resources[i] = resource
+	}
+
+	return resources, nil
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	"greenlight.311102.xyz/internal/data"
+	"greenlight.311102.xyz/internal/validator"
+	"net/http"
+	"net/url"
+)
+
+func (app *application) listGenresHandler(w http.ResponseWriter, r *http.Request) {
+	genres, err := app.models.Genres.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"genres": genres}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showGenreHandler(w http.ResponseWriter, r *http.Request) {
+	genre, ok := app.readGenre(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.writeResponse(w, r, http.StatusOK, envelope{"genre": genre}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createGenreInput 是 POST /v1/genres 的请求体。
+type createGenreInput struct {
+	Name    string   `json:"name"`
+	Aliases []string `json:"aliases"`
+}
+
+func (app *application) createGenreHandler(w http.ResponseWriter, r *http.Request) {
+	var input createGenreInput
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// 别名与 slug 使用相同的规则保存，这样 "Science Fiction" 和 "science-fiction" 是同一个别名。
+	genre := &data.Genre{
+		Slug:    data.GenreSlug(input.Name),
+		Name:    input.Name,
+		Aliases: make([]string, 0, len(input.Aliases)),
+	}
+	for _, alias := range input.Aliases {
+		genre.Aliases = append(genre.Aliases, data.GenreSlug(alias))
+	}
+
+	v := validator.New()
+	if data.ValidateGenre(v, genre); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Genres.Insert(genre)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateGenre):
+			v.AddError("name", "a genre with this name or alias already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	// slug 可能包含非 ASCII 字符，需要转义之后才能放在标头中。
+	headers.Set("Location", fmt.Sprintf("/v1/genres/%s", url.PathEscape(genre.Slug)))
+
+	err = app.writeResponse(w, r, http.StatusCreated, envelope{"genre": genre}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// renameGenreInput 是 PATCH /v1/genres/:slug 的请求体。
+type renameGenreInput struct {
+	Name string `json:"name"`
+}
+
+// renameGenreHandler 修改类型的显示名称。如果 slug 随之改变，所有使用该类型的影片会在同一个事务中被改写。
+func (app *application) renameGenreHandler(w http.ResponseWriter, r *http.Request) {
+	genre, ok := app.readGenre(w, r)
+	if !ok {
+		return
+	}
+
+	var input renameGenreInput
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateGenre(v, &data.Genre{Slug: data.GenreSlug(input.Name), Name: input.Name}); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	affected, err := app.models.Genres.Rename(genre, input.Name, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateGenre):
+			v.AddError("name", "a genre with this name or alias already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"genre": genre, "movies_updated": affected}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// mergeGenreInput 是 POST /v1/genres/:slug/merge 的请求体。
+type mergeGenreInput struct {
+	Into string `json:"into"`
+}
+
+// mergeGenreHandler 把 URL 中的类型合并到 into 指定的类型中，合并之后 URL 中的类型被删除，它的 slug 和别名成为目标类型的别名。
+func (app *application) mergeGenreHandler(w http.ResponseWriter, r *http.Request) {
+	source, ok := app.readGenre(w, r)
+	if !ok {
+		return
+	}
+
+	var input mergeGenreInput
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Into != "", "into", "must be provided")
+	v.Check(input.Into != source.Slug, "into", "must be a different genre")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	target, err := app.models.Genres.Get(input.Into)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("into", "must refer to an existing genre")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// 在读取之后，两个类型中的任何一个都可能已经被并发的请求删除或修改。
+	affected, err := app.models.Genres.Merge(source, target, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"genre": target, "movies_updated": affected}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readGenre() 读取 URL 中 slug 指定的类型。找不到时发送 404 响应并返回 false。
+func (app *application) readGenre(w http.ResponseWriter, r *http.Request) (*data.Genre, bool) {
+	slug := httprouter.ParamsFromContext(r.Context()).ByName("slug")
+
+	genre, err := app.models.Genres.Get(slug)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return genre, true
+}
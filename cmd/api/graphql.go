@@ -0,0 +1,698 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"greenlight.311102.xyz/internal/data"
+	"math"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// maxGraphQLDepth 限制查询中选择集的嵌套深度，避免客户端构造出代价过高的查询。
+const maxGraphQLDepth = 10
+
+// maxGraphQLComplexity 限制一个查询中所有字段的 cost 之和。执行器每层的每个字段只解析一次，但别名会让同一个字段解析多次，
+// 例如 a: movies(page: 1) b: movies(page: 2) 会执行两次查询，只限制深度无法阻止客户端用大量别名放大一个请求的代价。
+const maxGraphQLComplexity = 20
+
+// graphqlRequest 是 POST /v1/graphql 的请求体，与常见的 GraphQL 客户端发送的格式相同。
+type graphqlRequest struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName,omitempty"`
+	Variables     map[string]any `json:"variables,omitempty"`
+	Extensions    map[string]any `json:"extensions,omitempty"` // 一些客户端会发送 extensions（例如持久化查询的哈希），这里忽略它
+}
+
+// graphqlResponse 只用于 OpenAPI 文档，处理程序使用 envelope 写入响应。
+type graphqlResponse struct {
+	Data   map[string]any `json:"data,omitempty"`
+	Errors []gqlError     `json:"errors,omitempty"`
+}
+
+// gqlError 是 GraphQL 响应中的一个错误。extensions.code 给出错误的类别，例如 FORBIDDEN 和 FAILED_VALIDATION。
+type gqlError struct {
+	Message    string         `json:"message"`
+	Locations  []gqlLocation  `json:"locations,omitempty"`
+	Path       []any          `json:"path,omitempty"`
+	Extensions map[string]any `json:"extensions,omitempty"`
+}
+
+func (e *gqlError) Error() string {
+	return e.Message
+}
+
+func newGQLError(code, message string) *gqlError {
+	return &gqlError{Message: message, Extensions: map[string]any{"code": code}}
+}
+
+// gqlValidationError() 把验证器的错误转换为字段错误，错误的键与 REST 接口的 422 响应相同。
+func gqlValidationError(errs map[string]string) *gqlError {
+	err := newGQLError("FAILED_VALIDATION", "the arguments failed validation")
+	err.Extensions["errors"] = errs
+	return err
+}
+
+// gqlObject 是 GraphQL 模式中的一个对象类型。
+type gqlObject struct {
+	name   string
+	fields map[string]*gqlField
+}
+
+// gqlField 是对象类型中的一个字段。
+type gqlField struct {
+	args    map[string]string // 参数名到参数类型的映射，例如 "page": "Int"，"id": "ID!"
+	access  string            // 访问要求，与 routes() 中端点的访问要求相同
+	object  *gqlObject        // 字段的值是对象或对象列表时，对应的对象类型；标量字段为 nil
+	cost    int               // 每次解析这个字段的代价，需要查询数据库的字段为 1，计入 maxGraphQLComplexity
+	resolve gqlResolver
+}
+
+// gqlResolver 为一组父对象一次性解析同一个字段，返回的值与 sources 一一对应。由于执行器是逐层执行查询的，
+// 同一层的所有父对象会被一起传入，解析器可以用一次查询加载所有关联数据，从而避免 N+1 查询。
+type gqlResolver func(req *gqlRequest, sources []any, args map[string]any) ([]any, error)
+
+// gqlProperty() 把读取单个属性的函数包装为解析器，适用于不需要访问数据库的字段。
+func gqlProperty[T any](get func(source T) any) gqlResolver {
+	return func(_ *gqlRequest, sources []any, _ map[string]any) ([]any, error) {
+		values := make([]any, len(sources))
+		for i, source := range sources {
+			values[i] = get(source.(T))
+		}
+		return values, nil
+	}
+}
+
+// gqlRequest 保存执行一个 GraphQL 请求时需要的状态。
+type gqlRequest struct {
+	app        *application
+	r          *http.Request
+	user       *data.User
+	doc        *gqlDocument
+	operation  *gqlOperation
+	variables  map[string]any
+	declared   map[string]bool
+	errors     []*gqlError
+	permission struct {
+		loaded bool
+		codes  data.Permissions
+	}
+}
+
+func (app *application) graphqlHandler(w http.ResponseWriter, r *http.Request) {
+	var input graphqlRequest
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if strings.TrimSpace(input.Query) == "" {
+		app.graphqlErrorResponse(w, r, newGQLError("BAD_REQUEST", "the query must be provided"))
+		return
+	}
+
+	doc, err := parseGraphQL(input.Query)
+	if err != nil {
+		var syntaxError *gqlSyntaxError
+		switch {
+		case errors.As(err, &syntaxError):
+			gqlErr := newGQLError("GRAPHQL_PARSE_FAILED", "syntax error: "+syntaxError.message)
+			gqlErr.Locations = []gqlLocation{syntaxError.loc}
+			app.graphqlErrorResponse(w, r, gqlErr)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	req := &gqlRequest{app: app, r: r, user: app.contextGetUser(r), doc: doc}
+
+	// 查询无法通过验证时不执行任何字段，与语法错误一样返回 400。
+	errs := req.prepare(input.OperationName, input.Variables)
+	if len(errs) > 0 {
+		app.graphqlErrorResponse(w, r, errs...)
+		return
+	}
+
+	env := envelope{"data": req.execute(graphqlQuery, []any{nil}, [][]any{{}}, req.operation.selections)[0]}
+	if len(req.errors) > 0 {
+		env["errors"] = req.errors
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// graphqlErrorResponse() 发送无法执行的 GraphQL 请求的错误，响应中只有 errors 而没有 data。
+func (app *application) graphqlErrorResponse(w http.ResponseWriter, r *http.Request, errs ...*gqlError) {
+	err := app.writeResponse(w, r, http.StatusBadRequest, envelope{"errors": errs}, nil)
+	if err != nil {
+		app.logError(r, err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// prepare() 选择要执行的操作，准备变量的值，并按照模式验证查询。
+func (req *gqlRequest) prepare(operationName string, variables map[string]any) []*gqlError {
+	for _, op := range req.doc.operations {
+		if operationName == "" && len(req.doc.operations) > 1 {
+			return []*gqlError{newGQLError("BAD_REQUEST", "operationName must be provided when the document contains more than one operation")}
+		}
+		if operationName == "" || op.name == operationName {
+			req.operation = op
+			break
+		}
+	}
+	if req.operation == nil {
+		return []*gqlError{newGQLError("BAD_REQUEST", fmt.Sprintf("unknown operation named %q", operationName))}
+	}
+	if req.operation.kind != "query" {
+		return []*gqlError{req.locatedError("BAD_REQUEST", "only query operations are supported", req.operation.loc)}
+	}
+
+	var errs []*gqlError
+
+	req.variables = map[string]any{}
+	req.declared = map[string]bool{}
+	for _, def := range req.operation.variables {
+		if req.declared[def.name] {
+			errs = append(errs, req.locatedError("GRAPHQL_VALIDATION_FAILED", fmt.Sprintf("there can be only one variable named \"$%s\"", def.name), def.loc))
+			continue
+		}
+		req.declared[def.name] = true
+
+		value, ok := variables[def.name]
+		switch {
+		case ok:
+			req.variables[def.name] = value
+		case def.hasDefault:
+			req.variables[def.name] = def.defaultValue
+		case strings.HasSuffix(def.typ, "!"):
+			errs = append(errs, req.locatedError("BAD_USER_INPUT", fmt.Sprintf("variable \"$%s\" of required type %q was not provided", def.name, def.typ), def.loc))
+		}
+	}
+
+	errs = append(errs, req.validateDirectives(req.operation.directives)...)
+	errs = append(errs, req.validate(graphqlQuery, req.operation.selections, 1, map[string]bool{})...)
+
+	// 片段没有循环引用时才能安全地计算代价。
+	if len(errs) == 0 {
+		complexity := 0
+		if req.addComplexity(graphqlQuery, req.operation.selections, &complexity); complexity > maxGraphQLComplexity {
+			errs = append(errs, req.locatedError("GRAPHQL_VALIDATION_FAILED", fmt.Sprintf("the query exceeds the maximum complexity of %d", maxGraphQLComplexity), req.operation.loc))
+		}
+	}
+	return errs
+}
+
+// addComplexity() 把选择集中所有字段的 cost 累加到 total 中。每个别名都单独计算，片段每展开一次计算一次。
+// total 超过 maxGraphQLComplexity 之后就不再继续计算，这样嵌套展开的片段也不会让计算本身的代价过高。
+func (req *gqlRequest) addComplexity(obj *gqlObject, selections []*gqlSelection, total *int) {
+	for _, s := range selections {
+		if *total > maxGraphQLComplexity {
+			return
+		}
+
+		switch {
+		case s.fragment != "":
+			req.addComplexity(obj, req.doc.fragments[s.fragment].selections, total)
+		case s.name == "":
+			req.addComplexity(obj, s.selections, total)
+		default:
+			field, ok := obj.fields[s.name]
+			if !ok {
+				continue
+			}
+			*total += field.cost
+			if field.object != nil {
+				req.addComplexity(field.object, s.selections, total)
+			}
+		}
+	}
+}
+
+func (req *gqlRequest) locatedError(code, message string, loc gqlLocation) *gqlError {
+	err := newGQLError(code, message)
+	err.Locations = []gqlLocation{loc}
+	return err
+}
+
+// validate() 检查选择集中的每个字段、参数和片段是否符合模式。fragments 保存正在展开的片段，用于发现循环引用。
+func (req *gqlRequest) validate(obj *gqlObject, selections []*gqlSelection, depth int, fragments map[string]bool) []*gqlError {
+	invalid := func(message string, loc gqlLocation) []*gqlError {
+		return []*gqlError{req.locatedError("GRAPHQL_VALIDATION_FAILED", message, loc)}
+	}
+
+	if depth > maxGraphQLDepth {
+		return invalid(fmt.Sprintf("the query exceeds the maximum depth of %d", maxGraphQLDepth), selections[0].loc)
+	}
+
+	var errs []*gqlError
+	seen := map[string]*gqlSelection{}
+
+	for _, s := range selections {
+		errs = append(errs, req.validateDirectives(s.directives)...)
+
+		switch {
+		case s.fragment != "":
+			fragment, ok := req.doc.fragments[s.fragment]
+			switch {
+			case !ok:
+				errs = append(errs, invalid(fmt.Sprintf("unknown fragment %q", s.fragment), s.loc)...)
+			case fragments[s.fragment]:
+				errs = append(errs, invalid(fmt.Sprintf("cannot spread fragment %q within itself", s.fragment), s.loc)...)
+			case fragment.typeCondition != obj.name:
+				errs = append(errs, invalid(fmt.Sprintf("fragment %q cannot be spread here as objects of type %q can never be of type %q", s.fragment, obj.name, fragment.typeCondition), s.loc)...)
+			default:
+				fragments[s.fragment] = true
+				errs = append(errs, req.validateDirectives(fragment.directives)...)
+				errs = append(errs, req.validate(obj, fragment.selections, depth, fragments)...)
+				delete(fragments, s.fragment)
+			}
+		case s.name == "":
+			if s.typeCondition != "" && s.typeCondition != obj.name {
+				errs = append(errs, invalid(fmt.Sprintf("fragment cannot be spread here as objects of type %q can never be of type %q", obj.name, s.typeCondition), s.loc)...)
+				continue
+			}
+			errs = append(errs, req.validate(obj, s.selections, depth, fragments)...)
+		default:
+			// 同一个响应键只能对应同一个字段和相同的参数，否则结果无法合并。
+			if other, ok := seen[s.responseKey()]; ok && (other.name != s.name || !reflect.DeepEqual(other.arguments, s.arguments)) {
+				errs = append(errs, invalid(fmt.Sprintf("fields %q conflict because they select different fields or use different arguments", s.responseKey()), s.loc)...)
+			}
+			seen[s.responseKey()] = s
+
+			if s.name == "__typename" {
+				if s.arguments != nil || s.selections != nil {
+					errs = append(errs, invalid("field \"__typename\" must not have arguments or a selection", s.loc)...)
+				}
+				continue
+			}
+
+			field, ok := obj.fields[s.name]
+			if !ok {
+				errs = append(errs, invalid(fmt.Sprintf("cannot query field %q on type %q", s.name, obj.name), s.loc)...)
+				continue
+			}
+
+			_, err := req.coerceArguments(field.args, s.arguments)
+			if err != nil {
+				errs = append(errs, invalid(err.Error(), s.loc)...)
+			}
+
+			switch {
+			case field.object != nil && s.selections == nil:
+				errs = append(errs, invalid(fmt.Sprintf("field %q of type %q must have a selection of subfields", s.name, field.object.name), s.loc)...)
+			case field.object == nil && s.selections != nil:
+				errs = append(errs, invalid(fmt.Sprintf("field %q must not have a selection since it is a scalar", s.name), s.loc)...)
+			case field.object != nil:
+				errs = append(errs, req.validate(field.object, s.selections, depth+1, fragments)...)
+			}
+		}
+	}
+
+	return errs
+}
+
+// validateDirectives() 检查指令。只支持 @skip(if: Boolean!) 和 @include(if: Boolean!)。
+func (req *gqlRequest) validateDirectives(directives []*gqlDirective) []*gqlError {
+	var errs []*gqlError
+	for _, d := range directives {
+		if d.name != "skip" && d.name != "include" {
+			errs = append(errs, req.locatedError("GRAPHQL_VALIDATION_FAILED", fmt.Sprintf("unknown directive \"@%s\"", d.name), d.loc))
+			continue
+		}
+		_, err := req.coerceArguments(map[string]string{"if": "Boolean!"}, d.arguments)
+		if err != nil {
+			errs = append(errs, req.locatedError("GRAPHQL_VALIDATION_FAILED", err.Error(), d.loc))
+		}
+	}
+	return errs
+}
+
+// included() 根据 @skip 和 @include 指令判断是否需要执行某个选择。指令已经通过了验证。
+func (req *gqlRequest) included(directives []*gqlDirective) bool {
+	for _, d := range directives {
+		args, _ := req.coerceArguments(map[string]string{"if": "Boolean!"}, d.arguments)
+		if args["if"] == (d.name == "skip") {
+			return false
+		}
+	}
+	return true
+}
+
+// coerceArguments() 按照参数类型转换参数的值，变量会被替换为请求中提供的值。没有提供（或值为 null）的可选参数不会出现在结果中。
+func (req *gqlRequest) coerceArguments(types map[string]string, arguments map[string]any) (map[string]any, error) {
+	for name := range arguments {
+		if _, ok := types[name]; !ok {
+			return nil, fmt.Errorf("unknown argument %q", name)
+		}
+	}
+
+	args := make(map[string]any, len(arguments))
+	for name, typ := range types {
+		value, err := req.resolveVariables(arguments[name])
+		if err != nil {
+			return nil, err
+		}
+
+		if value == nil {
+			if strings.HasSuffix(typ, "!") {
+				return nil, fmt.Errorf("argument %q of type %q is required", name, typ)
+			}
+			continue
+		}
+
+		args[name], err = coerceValue(typ, value)
+		if err != nil {
+			return nil, fmt.Errorf("argument %q %s", name, err)
+		}
+	}
+
+	return args, nil
+}
+
+// resolveVariables() 把值中的变量替换为变量的值。没有提供的变量视为 null。
+func (req *gqlRequest) resolveVariables(value any) (any, error) {
+	switch v := value.(type) {
+	case gqlVariable:
+		if !req.declared[string(v)] {
+			return nil, fmt.Errorf("variable \"$%s\" is not defined", v)
+		}
+		return req.variables[string(v)], nil
+	case []any:
+		list := make([]any, len(v))
+		for i, item := range v {
+			var err error
+			list[i], err = req.resolveVariables(item)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+	default:
+		return value, nil
+	}
+}
+
+// coerceValue() 把值转换为 typ 对应的 Go 类型：Int 为 int，Float 为 float64，String 为 string，Boolean 为 bool，
+// ID 为 int64（这个 API 中所有的 ID 都是整数），列表为 []any。值可以来自查询中的字面量，也可以来自 JSON 中的变量。
+func coerceValue(typ string, value any) (any, error) {
+	nonNull := strings.HasSuffix(typ, "!")
+	typ = strings.TrimSuffix(typ, "!")
+
+	if value == nil {
+		if nonNull {
+			return nil, fmt.Errorf("must not be null")
+		}
+		return nil, nil
+	}
+
+	if strings.HasPrefix(typ, "[") {
+		itemType := strings.TrimSuffix(strings.TrimPrefix(typ, "["), "]")
+
+		// 按照规范，列表类型的参数也可以接受单个值，此时把它当作只有一个元素的列表。
+		items, ok := value.([]any)
+		if !ok {
+			items = []any{value}
+		}
+
+		list := make([]any, len(items))
+		for i, item := range items {
+			var err error
+			list[i], err = coerceValue(itemType, item)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+	}
+
+	switch typ {
+	case "Int":
+		var n float64
+		switch v := value.(type) {
+		case int64:
+			n = float64(v)
+		case float64:
+			n = v
+		default:
+			return nil, fmt.Errorf("must be an Int")
+		}
+		if n != math.Trunc(n) || n < math.MinInt32 || n > math.MaxInt32 {
+			return nil, fmt.Errorf("must be a 32-bit integer")
+		}
+		return int(n), nil
+	case "Float":
+		switch v := value.(type) {
+		case int64:
+			return float64(v), nil
+		case float64:
+			return v, nil
+		}
+		return nil, fmt.Errorf("must be a Float")
+	case "String":
+		if s, ok := value.(string); ok {
+			return s, nil
+		}
+		return nil, fmt.Errorf("must be a String")
+	case "Boolean":
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+		return nil, fmt.Errorf("must be a Boolean")
+	case "ID":
+		var id int64
+		var err error
+		switch v := value.(type) {
+		case string:
+			id, err = strconv.ParseInt(v, 10, 64)
+		case int64:
+			id = v
+		case float64:
+			id = int64(v)
+			if float64(id) != v {
+				err = errors.New("not an integer")
+			}
+		default:
+			err = errors.New("not an ID")
+		}
+		if err != nil || id < 1 {
+			return nil, fmt.Errorf("must be a valid ID")
+		}
+		return id, nil
+	}
+
+	panic("graphql: unknown argument type " + typ)
+}
+
+// gqlCollectedField 是选择集中使用同一个响应键的所有字段。
+type gqlCollectedField struct {
+	key        string
+	selections []*gqlSelection
+}
+
+// collectFields() 展开片段并应用指令，按照字段在查询中第一次出现的顺序返回需要执行的字段。
+func (req *gqlRequest) collectFields(selections []*gqlSelection, fields []*gqlCollectedField) []*gqlCollectedField {
+	for _, s := range selections {
+		if !req.included(s.directives) {
+			continue
+		}
+
+		switch {
+		case s.fragment != "":
+			fragment := req.doc.fragments[s.fragment]
+			if req.included(fragment.directives) {
+				fields = req.collectFields(fragment.selections, fields)
+			}
+		case s.name == "":
+			fields = req.collectFields(s.selections, fields)
+		default:
+			i := slices.IndexFunc(fields, func(f *gqlCollectedField) bool { return f.key == s.responseKey() })
+			if i < 0 {
+				fields = append(fields, &gqlCollectedField{key: s.responseKey()})
+				i = len(fields) - 1
+			}
+			fields[i].selections = append(fields[i].selections, s)
+		}
+	}
+	return fields
+}
+
+// execute() 为一组同类型的对象执行选择集，返回每个对象的结果。paths 是每个对象在响应中的位置，用于错误信息。
+// 查询按层执行：每个字段只调用一次解析器，然后把所有子对象收集起来，再一起执行下一层的选择集。
+func (req *gqlRequest) execute(obj *gqlObject, sources []any, paths [][]any, selections []*gqlSelection) []orderedObject {
+	results := make([]orderedObject, len(sources))
+	if len(sources) == 0 {
+		return results
+	}
+
+	for _, f := range req.collectFields(selections, nil) {
+		s := f.selections[0]
+
+		if s.name == "__typename" {
+			for i := range results {
+				results[i] = append(results[i], orderedField{f.key, obj.name})
+			}
+			continue
+		}
+
+		field := obj.fields[s.name]
+
+		// 同一层的所有对象只解析一次，出错时也只报告一个错误，路径使用第一个对象的位置。
+		values, err := req.resolve(field, sources, s.arguments)
+		if err != nil {
+			req.fieldError(err, appendPath(paths[0], f.key), s.loc)
+			values = make([]any, len(sources))
+		}
+
+		if field.object != nil {
+			var subselections []*gqlSelection
+			for _, s := range f.selections {
+				subselections = append(subselections, s.selections...)
+			}
+			req.executeObjects(field.object, values, paths, f.key, subselections)
+		}
+
+		for i := range results {
+			results[i] = append(results[i], orderedField{f.key, values[i]})
+		}
+	}
+
+	return results
+}
+
+// executeObjects() 把 values 中的对象（或对象列表）替换为执行选择集后的结果。
+func (req *gqlRequest) executeObjects(obj *gqlObject, values []any, paths [][]any, key string, selections []*gqlSelection) {
+	// slot 记录每个子对象的结果应该写回的位置：values 本身或者某个列表中的一项。
+	type slot struct {
+		list  []any
+		index int
+	}
+
+	var children []any
+	var childPaths [][]any
+	var slots []slot
+
+	for i, value := range values {
+		if isNilValue(value) {
+			values[i] = nil
+			continue
+		}
+
+		path := appendPath(paths[i], key)
+
+		rv := reflect.ValueOf(value)
+		if rv.Kind() != reflect.Slice {
+			children = append(children, value)
+			childPaths = append(childPaths, path)
+			slots = append(slots, slot{values, i})
+			continue
+		}
+
+		items := make([]any, rv.Len())
+		for j := range items {
+			item := rv.Index(j).Interface()
+			if isNilValue(item) {
+				continue
+			}
+			children = append(children, item)
+			childPaths = append(childPaths, appendPath(path, j))
+			slots = append(slots, slot{items, j})
+		}
+		values[i] = items
+	}
+
+	for i, result := range req.execute(obj, children, childPaths, selections) {
+		slots[i].list[slots[i].index] = result
+	}
+}
+
+// resolve() 检查访问要求，然后调用字段的解析器。
+func (req *gqlRequest) resolve(field *gqlField, sources []any, arguments map[string]any) ([]any, error) {
+	err := req.checkAccess(field.access)
+	if err != nil {
+		return nil, err
+	}
+
+	args, err := req.coerceArguments(field.args, arguments)
+	if err != nil {
+		return nil, newGQLError("BAD_USER_INPUT", err.Error())
+	}
+
+	return field.resolve(req, sources, args)
+}
+
+// checkAccess() 使用与 requireAccess() 相同的规则检查当前用户能否访问某个字段。
+// 用户的权限在每个请求中最多只读取一次。
+func (req *gqlRequest) checkAccess(access string) error {
+	if access == accessPublic {
+		return nil
+	}
+
+	if req.user.IsAnonymous() {
+		return newGQLError("UNAUTHENTICATED", "you must be authenticated to access this resource")
+	}
+	if !req.user.Activated {
+		return newGQLError("FORBIDDEN", "your user account must be activated to access this resource")
+	}
+	if access == accessActivated {
+		return nil
+	}
+
+	permissions, err := req.permissions()
+	if err != nil {
+		return err
+	}
+	if !permissions.Include(access) {
+		return newGQLError("FORBIDDEN", "your user account doesn't have the necessary permissions to access this resource")
+	}
+
+	return nil
+}
+
+func (req *gqlRequest) permissions() (data.Permissions, error) {
+	if !req.permission.loaded {
+		codes, err := req.app.models.Permissions.GetAllForUser(req.user.ID)
+		if err != nil {
+			return nil, err
+		}
+		req.permission.loaded = true
+		req.permission.codes = codes
+	}
+	return req.permission.codes, nil
+}
+
+// fieldError() 记录一个字段错误。GraphQL 错误会原样返回给客户端，其他错误只记录到日志中，客户端只会看到一个通用的错误信息。
+func (req *gqlRequest) fieldError(err error, path []any, loc gqlLocation) {
+	var gqlErr *gqlError
+	if !errors.As(err, &gqlErr) {
+		req.app.logError(req.r, err)
+		gqlErr = newGQLError("INTERNAL_SERVER_ERROR", "the server encountered a problem and could not process your request")
+	}
+
+	located := *gqlErr
+	located.Path = path
+	located.Locations = []gqlLocation{loc}
+	req.errors = append(req.errors, &located)
+}
+
+func appendPath(path []any, element any) []any {
+	return append(slices.Clip(path), element)
+}
+
+// isNilValue() 检查值是否为 nil，包括装在接口中的 nil 指针。
+func isNilValue(value any) bool {
+	if value == nil {
+		return true
+	}
+	rv := reflect.ValueOf(value)
+	return rv.Kind() == reflect.Pointer && rv.IsNil()
+}
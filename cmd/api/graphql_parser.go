@@ -0,0 +1,786 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// 这里实现了 GraphQL 查询文档的一个子集：查询操作、变量、别名、参数、具名片段、内联片段以及 @skip 和 @include 指令。
+// 不支持的语法（例如类型系统定义）会作为语法错误报告。
+
+// gqlDocument 是解析后的查询文档。
+type gqlDocument struct {
+	operations []*gqlOperation
+	fragments  map[string]*gqlFragment
+}
+
+type gqlOperation struct {
+	kind       string // query、mutation 或 subscription
+	name       string
+	variables  []*gqlVariableDefinition
+	directives []*gqlDirective
+	selections []*gqlSelection
+	loc        gqlLocation
+}
+
+type gqlVariableDefinition struct {
+	name         string
+	typ          string // 变量的类型，例如 [String!]!
+	defaultValue any
+	hasDefault   bool
+	loc          gqlLocation
+}
+
+type gqlFragment struct {
+	name          string
+	typeCondition string
+	directives    []*gqlDirective
+	selections    []*gqlSelection
+	loc           gqlLocation
+}
+
+// gqlSelection 是选择集中的一项：字段（name 不为空）、片段展开（fragment 不为空）或内联片段（其余情况）。
+type gqlSelection struct {
+	alias         string
+	name          string
+	arguments     map[string]any
+	fragment      string
+	typeCondition string
+	directives    []*gqlDirective
+	selections    []*gqlSelection
+	loc           gqlLocation
+}
+
+// responseKey() 返回字段在响应中的键，即别名或字段名。
+func (s *gqlSelection) responseKey() string {
+	if s.alias != "" {
+		return s.alias
+	}
+	return s.name
+}
+
+type gqlDirective struct {
+	name      string
+	arguments map[string]any
+	loc       gqlLocation
+}
+
+// 参数的值解析为 Go 的值：Int 为 int64，Float 为 float64，String 为 string，Boolean 为 bool，null 为 nil，
+// 列表为 []any，输入对象为 map[string]any，变量和枚举值分别使用下面的两个类型。
+type gqlVariable string
+
+type gqlEnum string
+
+type gqlLocation struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// gqlSyntaxError 是查询文档中的语法错误。
+type gqlSyntaxError struct {
+	message string
+	loc     gqlLocation
+}
+
+func (e *gqlSyntaxError) Error() string {
+	return fmt.Sprintf("syntax error: %s (line %d, column %d)", e.message, e.loc.Line, e.loc.Column)
+}
+
+type gqlTokenKind int
+
+const (
+	gqlEOF gqlTokenKind = iota
+	gqlPunctuator
+	gqlName
+	gqlInt
+	gqlFloat
+	gqlString
+)
+
+type gqlToken struct {
+	kind  gqlTokenKind
+	value string
+	loc   gqlLocation
+}
+
+// gqlLexer 把查询文档切分为词法单元。逗号与空白一样会被忽略。
+type gqlLexer struct {
+	src  string
+	pos  int
+	line int
+	col  int
+}
+
+func (l *gqlLexer) next() (gqlToken, error) {
+	l.skipIgnored()
+
+	loc := gqlLocation{Line: l.line, Column: l.col}
+	if l.pos >= len(l.src) {
+		return gqlToken{kind: gqlEOF, loc: loc}, nil
+	}
+
+	c := l.src[l.pos]
+	switch {
+	case strings.IndexByte("!$&()=:@[]{}|", c) >= 0:
+		l.advance(1)
+		return gqlToken{kind: gqlPunctuator, value: string(c), loc: loc}, nil
+	case c == '.':
+		if !strings.HasPrefix(l.src[l.pos:], "...") {
+			return gqlToken{}, &gqlSyntaxError{"unexpected \".\"", loc}
+		}
+		l.advance(3)
+		return gqlToken{kind: gqlPunctuator, value: "...", loc: loc}, nil
+	case c == '_' || isLetter(c):
+		start := l.pos
+		for l.pos < len(l.src) && (l.src[l.pos] == '_' || isLetter(l.src[l.pos]) || isDigit(l.src[l.pos])) {
+			l.advance(1)
+		}
+		return gqlToken{kind: gqlName, value: l.src[start:l.pos], loc: loc}, nil
+	case c == '-' || isDigit(c):
+		return l.number(loc)
+	case c == '"':
+		return l.string(loc)
+	}
+
+	r, _ := utf8.DecodeRuneInString(l.src[l.pos:])
+	return gqlToken{}, &gqlSyntaxError{fmt.Sprintf("unexpected character %q", r), loc}
+}
+
+// skipIgnored() 跳过空白、换行、逗号、注释和 BOM。
+func (l *gqlLexer) skipIgnored() {
+	for l.pos < len(l.src) {
+		switch c := l.src[l.pos]; {
+		case c == ' ' || c == '\t' || c == ',' || c == '\r':
+			l.advance(1)
+		case c == '\n':
+			l.pos++
+			l.line++
+			l.col = 1
+		case c == '#':
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.advance(1)
+			}
+		case strings.HasPrefix(l.src[l.pos:], "\uFEFF"):
+			l.pos += len("\uFEFF")
+		default:
+			return
+		}
+	}
+}
+
+func (l *gqlLexer) advance(n int) {
+	l.pos += n
+	l.col += n
+}
+
+func (l *gqlLexer) number(loc gqlLocation) (gqlToken, error) {
+	start := l.pos
+	kind := gqlInt
+
+	if l.src[l.pos] == '-' {
+		l.advance(1)
+	}
+	digits := func() int {
+		n := 0
+		for l.pos < len(l.src) && isDigit(l.src[l.pos]) {
+			l.advance(1)
+			n++
+		}
+		return n
+	}
+
+	if digits() == 0 {
+		return gqlToken{}, &gqlSyntaxError{"invalid number", loc}
+	}
+	if l.pos < len(l.src) && l.src[l.pos] == '.' {
+		kind = gqlFloat
+		l.advance(1)
+		if digits() == 0 {
+			return gqlToken{}, &gqlSyntaxError{"invalid number", loc}
+		}
+	}
+	if l.pos < len(l.src) && (l.src[l.pos] == 'e' || l.src[l.pos] == 'E') {
+		kind = gqlFloat
+		l.advance(1)
+		if l.pos < len(l.src) && (l.src[l.pos] == '+' || l.src[l.pos] == '-') {
+			l.advance(1)
+		}
+		if digits() == 0 {
+			return gqlToken{}, &gqlSyntaxError{"invalid number", loc}
+		}
+	}
+	// 数字后面不能紧跟名称或小数点，例如 123abc。
+	if l.pos < len(l.src) && (l.src[l.pos] == '.' || l.src[l.pos] == '_' || isLetter(l.src[l.pos])) {
+		return gqlToken{}, &gqlSyntaxError{"invalid number", loc}
+	}
+
+	return gqlToken{kind: kind, value: l.src[start:l.pos], loc: loc}, nil
+}
+
+// string() 读取普通字符串或块字符串（"""...""")。块字符串的缩进按照规范去除。
+func (l *gqlLexer) string(loc gqlLocation) (gqlToken, error) {
+	if strings.HasPrefix(l.src[l.pos:], `"""`) {
+		l.advance(3)
+		var b strings.Builder
+		for {
+			if l.pos >= len(l.src) {
+				return gqlToken{}, &gqlSyntaxError{"unterminated string", loc}
+			}
+			switch {
+			case strings.HasPrefix(l.src[l.pos:], `"""`):
+				l.advance(3)
+				return gqlToken{kind: gqlString, value: blockStringValue(b.String()), loc: loc}, nil
+			case strings.HasPrefix(l.src[l.pos:], `\"""`):
+				b.WriteString(`"""`)
+				l.advance(4)
+			case l.src[l.pos] == '\n':
+				b.WriteByte('\n')
+				l.pos++
+				l.line++
+				l.col = 1
+			default:
+				b.WriteByte(l.src[l.pos])
+				l.advance(1)
+			}
+		}
+	}
+
+	l.advance(1)
+	var b strings.Builder
+	for {
+		if l.pos >= len(l.src) || l.src[l.pos] == '\n' || l.src[l.pos] == '\r' {
+			return gqlToken{}, &gqlSyntaxError{"unterminated string", loc}
+		}
+
+		c := l.src[l.pos]
+		switch c {
+		case '"':
+			l.advance(1)
+			return gqlToken{kind: gqlString, value: b.String(), loc: loc}, nil
+		case '\\':
+			if l.pos+1 >= len(l.src) {
+				return gqlToken{}, &gqlSyntaxError{"unterminated string", loc}
+			}
+			escape := l.src[l.pos+1]
+			if escape == 'u' {
+				if l.pos+6 > len(l.src) {
+					return gqlToken{}, &gqlSyntaxError{"invalid unicode escape", loc}
+				}
+				code, err := strconv.ParseUint(l.src[l.pos+2:l.pos+6], 16, 32)
+				if err != nil {
+					return gqlToken{}, &gqlSyntaxError{"invalid unicode escape", loc}
+				}
+				b.WriteRune(rune(code))
+				l.advance(6)
+				continue
+			}
+			replacement, ok := map[byte]byte{'"': '"', '\\': '\\', '/': '/', 'b': '\b', 'f': '\f', 'n': '\n', 'r': '\r', 't': '\t'}[escape]
+			if !ok {
+				return gqlToken{}, &gqlSyntaxError{fmt.Sprintf("invalid escape sequence \\%c", escape), loc}
+			}
+			b.WriteByte(replacement)
+			l.advance(2)
+		default:
+			b.WriteByte(c)
+			l.advance(1)
+		}
+	}
+}
+
+// blockStringValue() 去除块字符串的公共缩进以及首尾的空行。
+func blockStringValue(raw string) string {
+	lines := strings.Split(strings.ReplaceAll(raw, "\r\n", "\n"), "\n")
+
+	indent := -1
+	for _, line := range lines[1:] {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed != "" && (indent < 0 || len(line)-len(trimmed) < indent) {
+			indent = len(line) - len(trimmed)
+		}
+	}
+	if indent > 0 {
+		for i := 1; i < len(lines); i++ {
+			lines[i] = lines[i][min(indent, len(lines[i])):]
+		}
+	}
+
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// gqlParser 是一个递归下降解析器，始终向前看一个词法单元。
+type gqlParser struct {
+	lexer *gqlLexer
+	token gqlToken
+}
+
+// parseGraphQL() 解析查询文档。
+func parseGraphQL(src string) (*gqlDocument, error) {
+	p := &gqlParser{lexer: &gqlLexer{src: src, line: 1, col: 1}}
+	err := p.advance()
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &gqlDocument{fragments: map[string]*gqlFragment{}}
+
+	for p.token.kind != gqlEOF {
+		switch {
+		case p.peek(gqlPunctuator, "{"):
+			loc := p.token.loc
+			selections, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, &gqlOperation{kind: "query", selections: selections, loc: loc})
+		case p.peek(gqlName, "query"), p.peek(gqlName, "mutation"), p.peek(gqlName, "subscription"):
+			op, err := p.operation()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, op)
+		case p.peek(gqlName, "fragment"):
+			fragment, err := p.fragment()
+			if err != nil {
+				return nil, err
+			}
+			if _, exists := doc.fragments[fragment.name]; exists {
+				return nil, &gqlSyntaxError{fmt.Sprintf("there can be only one fragment named %q", fragment.name), fragment.loc}
+			}
+			doc.fragments[fragment.name] = fragment
+		default:
+			return nil, p.unexpected()
+		}
+	}
+
+	if len(doc.operations) == 0 {
+		return nil, &gqlSyntaxError{"the document does not contain any operations", p.token.loc}
+	}
+
+	return doc, nil
+}
+
+func (p *gqlParser) advance() error {
+	token, err := p.lexer.next()
+	if err != nil {
+		return err
+	}
+	p.token = token
+	return nil
+}
+
+func (p *gqlParser) peek(kind gqlTokenKind, value string) bool {
+	return p.token.kind == kind && p.token.value == value
+}
+
+// skip() 在当前词法单元匹配时跳过它并返回 true。
+func (p *gqlParser) skip(kind gqlTokenKind, value string) (bool, error) {
+	if !p.peek(kind, value) {
+		return false, nil
+	}
+	return true, p.advance()
+}
+
+func (p *gqlParser) expect(kind gqlTokenKind, value string) error {
+	if !p.peek(kind, value) {
+		return p.unexpected()
+	}
+	return p.advance()
+}
+
+func (p *gqlParser) name() (string, error) {
+	if p.token.kind != gqlName {
+		return "", p.unexpected()
+	}
+	name := p.token.value
+	return name, p.advance()
+}
+
+func (p *gqlParser) unexpected() error {
+	if p.token.kind == gqlEOF {
+		return &gqlSyntaxError{"unexpected end of document", p.token.loc}
+	}
+	return &gqlSyntaxError{fmt.Sprintf("unexpected %q", p.token.value), p.token.loc}
+}
+
+func (p *gqlParser) operation() (*gqlOperation, error) {
+	op := &gqlOperation{kind: p.token.value, loc: p.token.loc}
+	err := p.advance()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.token.kind == gqlName {
+		op.name = p.token.value
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+
+	if ok, err := p.skip(gqlPunctuator, "("); err != nil {
+		return nil, err
+	} else if ok {
+		for !p.peek(gqlPunctuator, ")") {
+			def, err := p.variableDefinition()
+			if err != nil {
+				return nil, err
+			}
+			op.variables = append(op.variables, def)
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+
+	op.directives, err = p.directives()
+	if err != nil {
+		return nil, err
+	}
+
+	op.selections, err = p.selectionSet()
+	return op, err
+}
+
+func (p *gqlParser) variableDefinition() (*gqlVariableDefinition, error) {
+	def := &gqlVariableDefinition{loc: p.token.loc}
+
+	err := p.expect(gqlPunctuator, "$")
+	if err != nil {
+		return nil, err
+	}
+	def.name, err = p.name()
+	if err != nil {
+		return nil, err
+	}
+	err = p.expect(gqlPunctuator, ":")
+	if err != nil {
+		return nil, err
+	}
+	def.typ, err = p.typeReference()
+	if err != nil {
+		return nil, err
+	}
+
+	if ok, err := p.skip(gqlPunctuator, "="); err != nil {
+		return nil, err
+	} else if ok {
+		def.defaultValue, err = p.value(true)
+		if err != nil {
+			return nil, err
+		}
+		def.hasDefault = true
+	}
+
+	// 变量定义上的指令没有任何作用，解析后直接丢弃。
+	_, err = p.directives()
+	return def, err
+}
+
+// typeReference() 解析类型引用，并把它规范化为字符串，例如 [String!]!。
+func (p *gqlParser) typeReference() (string, error) {
+	var typ string
+
+	if ok, err := p.skip(gqlPunctuator, "["); err != nil {
+		return "", err
+	} else if ok {
+		item, err := p.typeReference()
+		if err != nil {
+			return "", err
+		}
+		if err := p.expect(gqlPunctuator, "]"); err != nil {
+			return "", err
+		}
+		typ = "[" + item + "]"
+	} else {
+		typ, err = p.name()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if ok, err := p.skip(gqlPunctuator, "!"); err != nil {
+		return "", err
+	} else if ok {
+		typ += "!"
+	}
+	return typ, nil
+}
+
+func (p *gqlParser) fragment() (*gqlFragment, error) {
+	fragment := &gqlFragment{loc: p.token.loc}
+
+	err := p.advance()
+	if err != nil {
+		return nil, err
+	}
+	fragment.name, err = p.name()
+	if err != nil {
+		return nil, err
+	}
+	if fragment.name == "on" {
+		return nil, &gqlSyntaxError{"a fragment cannot be named \"on\"", fragment.loc}
+	}
+	if err := p.expect(gqlName, "on"); err != nil {
+		return nil, err
+	}
+	fragment.typeCondition, err = p.name()
+	if err != nil {
+		return nil, err
+	}
+	fragment.directives, err = p.directives()
+	if err != nil {
+		return nil, err
+	}
+	fragment.selections, err = p.selectionSet()
+	return fragment, err
+}
+
+func (p *gqlParser) selectionSet() ([]*gqlSelection, error) {
+	loc := p.token.loc
+	err := p.expect(gqlPunctuator, "{")
+	if err != nil {
+		return nil, err
+	}
+
+	var selections []*gqlSelection
+	for {
+		if ok, err := p.skip(gqlPunctuator, "}"); err != nil {
+			return nil, err
+		} else if ok {
+			break
+		}
+
+		selection, err := p.selection()
+		if err != nil {
+			return nil, err
+		}
+		selections = append(selections, selection)
+	}
+
+	if len(selections) == 0 {
+		return nil, &gqlSyntaxError{"a selection set must not be empty", loc}
+	}
+	return selections, nil
+}
+
+func (p *gqlParser) selection() (*gqlSelection, error) {
+	s := &gqlSelection{loc: p.token.loc}
+
+	if ok, err := p.skip(gqlPunctuator, "..."); err != nil {
+		return nil, err
+	} else if ok {
+		switch {
+		case p.peek(gqlName, "on"):
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			s.typeCondition, err = p.name()
+			if err != nil {
+				return nil, err
+			}
+		case p.token.kind == gqlName:
+			s.fragment = p.token.value
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			s.directives, err = p.directives()
+			return s, err
+		}
+
+		s.directives, err = p.directives()
+		if err != nil {
+			return nil, err
+		}
+		s.selections, err = p.selectionSet()
+		return s, err
+	}
+
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	if ok, err := p.skip(gqlPunctuator, ":"); err != nil {
+		return nil, err
+	} else if ok {
+		s.alias = name
+		name, err = p.name()
+		if err != nil {
+			return nil, err
+		}
+	}
+	s.name = name
+
+	s.arguments, err = p.arguments(false)
+	if err != nil {
+		return nil, err
+	}
+	s.directives, err = p.directives()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.peek(gqlPunctuator, "{") {
+		s.selections, err = p.selectionSet()
+	}
+	return s, err
+}
+
+func (p *gqlParser) arguments(constant bool) (map[string]any, error) {
+	if ok, err := p.skip(gqlPunctuator, "("); err != nil || !ok {
+		return nil, err
+	}
+
+	arguments := map[string]any{}
+	for {
+		if ok, err := p.skip(gqlPunctuator, ")"); err != nil {
+			return nil, err
+		} else if ok {
+			break
+		}
+
+		loc := p.token.loc
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := arguments[name]; exists {
+			return nil, &gqlSyntaxError{fmt.Sprintf("there can be only one argument named %q", name), loc}
+		}
+		if err := p.expect(gqlPunctuator, ":"); err != nil {
+			return nil, err
+		}
+		arguments[name], err = p.value(constant)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(arguments) == 0 {
+		return nil, p.unexpected()
+	}
+	return arguments, nil
+}
+
+func (p *gqlParser) directives() ([]*gqlDirective, error) {
+	var directives []*gqlDirective
+	for p.peek(gqlPunctuator, "@") {
+		directive := &gqlDirective{loc: p.token.loc}
+		err := p.advance()
+		if err != nil {
+			return nil, err
+		}
+		directive.name, err = p.name()
+		if err != nil {
+			return nil, err
+		}
+		directive.arguments, err = p.arguments(false)
+		if err != nil {
+			return nil, err
+		}
+		directives = append(directives, directive)
+	}
+	return directives, nil
+}
+
+// value() 解析一个值。constant 为 true 时（例如变量的默认值）不允许使用变量。
+func (p *gqlParser) value(constant bool) (any, error) {
+	token := p.token
+
+	switch token.kind {
+	case gqlInt:
+		n, err := strconv.ParseInt(token.value, 10, 64)
+		if err != nil {
+			return nil, &gqlSyntaxError{"integer out of range: " + token.value, token.loc}
+		}
+		return n, p.advance()
+	case gqlFloat:
+		f, err := strconv.ParseFloat(token.value, 64)
+		if err != nil {
+			return nil, &gqlSyntaxError{"float out of range: " + token.value, token.loc}
+		}
+		return f, p.advance()
+	case gqlString:
+		return token.value, p.advance()
+	case gqlName:
+		err := p.advance()
+		switch token.value {
+		case "true":
+			return true, err
+		case "false":
+			return false, err
+		case "null":
+			return nil, err
+		default:
+			return gqlEnum(token.value), err
+		}
+	}
+
+	switch {
+	case p.peek(gqlPunctuator, "$") && !constant:
+		err := p.advance()
+		if err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		return gqlVariable(name), err
+	case p.peek(gqlPunctuator, "["):
+		err := p.advance()
+		if err != nil {
+			return nil, err
+		}
+		list := []any{}
+		for {
+			if ok, err := p.skip(gqlPunctuator, "]"); err != nil {
+				return nil, err
+			} else if ok {
+				return list, nil
+			}
+			item, err := p.value(constant)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, item)
+		}
+	case p.peek(gqlPunctuator, "{"):
+		err := p.advance()
+		if err != nil {
+			return nil, err
+		}
+		object := map[string]any{}
+		for {
+			if ok, err := p.skip(gqlPunctuator, "}"); err != nil {
+				return nil, err
+			} else if ok {
+				return object, nil
+			}
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(gqlPunctuator, ":"); err != nil {
+				return nil, err
+			}
+			object[name], err = p.value(constant)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return nil, p.unexpected()
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseGraphQL(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		err   string // 期望的语法错误信息，为空表示文档有效
+	}{
+		{"shorthand query", `{ me { id } }`, ""},
+		{"named query", `query Me { me { id name } }`, ""},
+		{"variables with defaults", `query Movies($page: Int = 1, $genres: [String!]!) { movies(page: $page, genres: $genres) { metadata { total_records } } }`, ""},
+		{"aliases and arguments", `{ a: movie(id: 1) { id } b: movie(id: "2") { title } }`, ""},
+		{"fragments", `query { movie(id: 1) { ...MovieFields } } fragment MovieFields on Movie { id title }`, ""},
+		{"inline fragment", `{ movie(id: 1) { ... on Movie { id } ... @include(if: true) { title } } }`, ""},
+		{"directives", `query ($skip: Boolean!) { me @skip(if: $skip) { id } }`, ""},
+		{"comments and commas", "# 注释\n{ me { id, name, }, }", ""},
+		{"block string", "{ movies(title: \"\"\"\n  Moana\n\"\"\") { metadata { total_records } } }", ""},
+		{"input values", `{ movies(genres: ["drama", "crime"], page: -1, sort: title, title: null) { metadata { page_size } } }`, ""},
+		{"byte order mark", "\uFEFF{ me { id } }", ""},
+
+		{"empty document", ``, "the document does not contain any operations"},
+		{"fragment only", `fragment F on Movie { id }`, "the document does not contain any operations"},
+		{"empty selection set", `{ }`, "a selection set must not be empty"},
+		{"empty nested selection set", `{ me { } }`, "a selection set must not be empty"},
+		{"unclosed selection set", `{ me { id }`, "unexpected end of document"},
+		{"unexpected token", `{ me { id } } }`, `unexpected "}"`},
+		{"empty arguments", `{ movie() { id } }`, `unexpected "{"`},
+		{"duplicate argument", `{ movie(id: 1, id: 2) { id } }`, `there can be only one argument named "id"`},
+		{"duplicate fragment", `{ me { ...F } } fragment F on User { id } fragment F on User { name }`, `there can be only one fragment named "F"`},
+		{"fragment named on", `{ me { id } } fragment on on User { id }`, `a fragment cannot be named "on"`},
+		{"variable in default value", `query ($a: Int = $b) { me { id } }`, `unexpected "$"`},
+		{"unterminated string", `{ movies(title: "Moana) { metadata { page_size } } }`, "unterminated string"},
+		{"invalid escape", `{ movies(title: "\q") { metadata { page_size } } }`, `invalid escape sequence \q`},
+		{"invalid unicode escape", `{ movies(title: "\u12") { metadata { page_size } } }`, "invalid unicode escape"},
+		{"invalid number", `{ movies(page: 1.) { metadata { page_size } } }`, "invalid number"},
+		{"number followed by name", `{ movies(page: 123abc) { metadata { page_size } } }`, "invalid number"},
+		{"integer out of range", `{ movies(page: 99999999999999999999) { metadata { page_size } } }`, "integer out of range: 99999999999999999999"},
+		{"single dot", `{ me { .id } }`, `unexpected "."`},
+		{"unexpected character", `{ me { id% } }`, "unexpected character '%'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := parseGraphQL(tt.query)
+
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if len(doc.operations) == 0 {
+					t.Fatal("want at least one operation")
+				}
+				return
+			}
+
+			var syntaxError *gqlSyntaxError
+			if !errors.As(err, &syntaxError) {
+				t.Fatalf("want syntax error %q; got %v", tt.err, err)
+			}
+			if syntaxError.message != tt.err {
+				t.Errorf("want message %q; got %q", tt.err, syntaxError.message)
+			}
+		})
+	}
+}
+
+func TestParseGraphQLErrorLocation(t *testing.T) {
+	_, err := parseGraphQL("{\n  me {\n    id\n  }\n  movie(id: 1) { }\n}")
+
+	var syntaxError *gqlSyntaxError
+	if !errors.As(err, &syntaxError) {
+		t.Fatalf("want syntax error; got %v", err)
+	}
+
+	want := gqlLocation{Line: 5, Column: 16}
+	if syntaxError.loc != want {
+		t.Errorf("want location %+v; got %+v", want, syntaxError.loc)
+	}
+}
+
+func TestParseGraphQLValues(t *testing.T) {
+	doc, err := parseGraphQL(`query ($title: String) {
+		movies(title: $title, page: 2, ratio: 1.5e2, sort: "-year", genres: ["drama"], filter: {a: true, b: null}, mode: EXACT, notes: """
+			first line
+			  indented
+		""") { metadata { page_size } }
+	}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := map[string]any{
+		"title":  gqlVariable("title"),
+		"page":   int64(2),
+		"ratio":  150.0,
+		"sort":   "-year",
+		"genres": []any{"drama"},
+		"filter": map[string]any{"a": true, "b": nil},
+		"mode":   gqlEnum("EXACT"),
+		"notes":  "first line\n  indented",
+	}
+
+	got := doc.operations[0].selections[0].arguments
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want arguments %#v; got %#v", want, got)
+	}
+}
+
+func TestGraphQLSelectionSets(t *testing.T) {
+	doc, err := parseGraphQL(`{ m: movie(id: 1) @skip(if: false) { id ... on Movie { title } ...F } } fragment F on Movie { year }`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	movie := doc.operations[0].selections[0]
+	if movie.alias != "m" || movie.name != "movie" || movie.responseKey() != "m" {
+		t.Errorf("want alias m of movie; got alias %q of %q", movie.alias, movie.name)
+	}
+	if len(movie.directives) != 1 || movie.directives[0].name != "skip" {
+		t.Errorf("want a single @skip directive; got %+v", movie.directives)
+	}
+	if len(movie.selections) != 3 {
+		t.Fatalf("want 3 selections; got %d", len(movie.selections))
+	}
+	if inline := movie.selections[1]; inline.typeCondition != "Movie" || len(inline.selections) != 1 {
+		t.Errorf("want an inline fragment on Movie; got %+v", inline)
+	}
+	if spread := movie.selections[2]; spread.fragment != "F" {
+		t.Errorf("want a spread of fragment F; got %+v", spread)
+	}
+	if fragment := doc.fragments["F"]; fragment == nil || fragment.typeCondition != "Movie" {
+		t.Errorf("want fragment F on Movie; got %+v", fragment)
+	}
+}
+
+// nestedGraphQLQuery() 返回选择集嵌套 depth 层的查询，例如 depth 为 2 时返回 { child { id } }。
+func nestedGraphQLQuery(depth int) string {
+	return "{ " + strings.Repeat("child { ", depth-1) + "id" + strings.Repeat(" }", depth-1) + " }"
+}
+
+func TestGraphQLMaxDepth(t *testing.T) {
+	// 实际的模式最多只有 5 层，这里使用一个可以无限嵌套的模式来测试深度限制。
+	node := &gqlObject{name: "Node"}
+	node.fields = map[string]*gqlField{
+		"id":    {},
+		"child": {object: node},
+	}
+
+	tests := []struct {
+		depth int
+		valid bool
+	}{
+		{1, true},
+		{maxGraphQLDepth, true},
+		{maxGraphQLDepth + 1, false},
+		{maxGraphQLDepth + 5, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("depth %d", tt.depth), func(t *testing.T) {
+			doc, err := parseGraphQL(nestedGraphQLQuery(tt.depth))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			req := &gqlRequest{doc: doc}
+			errs := req.validate(node, doc.operations[0].selections, 1, map[string]bool{})
+
+			switch {
+			case tt.valid && len(errs) > 0:
+				t.Errorf("unexpected errors: %v", errs[0])
+			case !tt.valid && (len(errs) != 1 || errs[0].Message != "the query exceeds the maximum depth of 10"):
+				t.Errorf("want a single max depth error; got %v", errs)
+			}
+		})
+	}
+}
+
+// aliasedGraphQLQuery() 返回用 n 个别名分别查询一部影片的查询，它的代价是 n。
+func aliasedGraphQLQuery(n int) string {
+	var b strings.Builder
+	b.WriteString("{ ")
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "m%d: movie(id: %d) { id } ", i, i+1)
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+func TestGraphQLPrepare(t *testing.T) {
+	tooComplex := fmt.Sprintf("the query exceeds the maximum complexity of %d", maxGraphQLComplexity)
+
+	tests := []struct {
+		name          string
+		query         string
+		operationName string
+		variables     map[string]any
+		err           string // 期望的第一个错误信息，为空表示查询有效
+	}{
+		{"valid query", `{ movie(id: 1) { id title rating { average } credits { person { name } } } }`, "", nil, ""},
+		{"aliases within the limit", aliasedGraphQLQuery(maxGraphQLComplexity), "", nil, ""},
+		{"aliased fan-out", aliasedGraphQLQuery(maxGraphQLComplexity + 1), "", nil, tooComplex},
+		{"fan-out through fragments", `{ ...A ...B } fragment A on Query { ` + strings.Trim(aliasedGraphQLQuery(10), "{}") + ` } fragment B on Query { a: movies { movies { c0: credits { id } c1: credits { id } c2: credits { id } c3: credits { id } c4: credits { id } c5: credits { id } c6: credits { id } c7: credits { id } c8: credits { id } c9: credits { id } } } }`, "", nil, tooComplex},
+		{"variables", `query ($id: ID!) { movie(id: $id) { id } }`, "", map[string]any{"id": "1"}, ""},
+		{"missing required variable", `query ($id: ID!) { movie(id: $id) { id } }`, "", nil, `variable "$id" of required type "ID!" was not provided`},
+		{"select an operation", `query A { me { id } } query B { movie(id: 1) { id } }`, "B", nil, ""},
+		{"ambiguous operation", `query A { me { id } } query B { me { id } }`, "", nil, "operationName must be provided when the document contains more than one operation"},
+		{"unknown operation", `query A { me { id } }`, "C", nil, `unknown operation named "C"`},
+		{"mutation", `mutation { me { id } }`, "", nil, "only query operations are supported"},
+		{"unknown field", `{ me { id password } }`, "", nil, `cannot query field "password" on type "User"`},
+		{"missing subfields", `{ me }`, "", nil, `field "me" of type "User" must have a selection of subfields`},
+		{"subfields on a scalar", `{ me { id { value } } }`, "", nil, `field "id" must not have a selection since it is a scalar`},
+		{"conflicting aliases", `{ m: movie(id: 1) { id } m: movie(id: 2) { id } }`, "", nil, `fields "m" conflict because they select different fields or use different arguments`},
+		{"unknown fragment", `{ me { ...F } }`, "", nil, `unknown fragment "F"`},
+		{"fragment cycle", `{ me { ...F } } fragment F on User { ...F }`, "", nil, `cannot spread fragment "F" within itself`},
+		{"fragment on the wrong type", `{ me { ...F } } fragment F on Movie { id }`, "", nil, `fragment "F" cannot be spread here as objects of type "User" can never be of type "Movie"`},
+		{"unknown directive", `{ me @defer { id } }`, "", nil, `unknown directive "@defer"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := parseGraphQL(tt.query)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			req := &gqlRequest{doc: doc}
+			errs := req.prepare(tt.operationName, tt.variables)
+
+			if tt.err == "" {
+				if len(errs) > 0 {
+					t.Errorf("unexpected error: %v", errs[0])
+				}
+				return
+			}
+
+			if len(errs) == 0 {
+				t.Fatalf("want error %q; got none", tt.err)
+			}
+			if errs[0].Message != tt.err {
+				t.Errorf("want error %q; got %q", tt.err, errs[0].Message)
+			}
+		})
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"greenlight.311102.xyz/internal/data"
+	"greenlight.311102.xyz/internal/validator"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// graphqlQuery 是 GraphQL 模式的根类型。模式对应的 SDL 如下（所有字段都可以为 null，出错的字段返回 null 并在 errors 中说明原因）：
+//
+//	type Query {
+//	  movie(id: ID!): Movie                                  # 需要 movies:read 权限
+//	  movies(title: String, language: String, search_mode: String, genres: [String], genres_any: [String], genres_none: [String],
+//	         year_min: Int, year_max: Int, run_time_min: Int, run_time_max: Int,
+//	         created_after: String, created_before: String, director: String, cast: String,
+//	         page: Int, page_size: Int, sort: String, cursor: String): MovieList   # 需要 movies:read 权限
+//	  me: User                                               # 需要已激活的用户
+//	}
+//	type MovieList { movies: [Movie] metadata: Metadata }
+//	type Metadata { current_page: Int page_size: Int first_page: Int last_page: Int total_records: Int next_cursor: String prev_cursor: String }
+//	type Movie { id: ID title: String year: Int run_time(format: String): RunTime genres: [String] version: Int rating: Rating poster: Poster credits: [Credit] }
+//	type Rating { average: Float count: Int }
+//	type Poster { url: String width: Int height: Int }
+//	type Credit { id: ID role: String character: String person: Person }
+//	type Person { id: ID name: String birth_year: Int }
+//	type User { id: ID name: String email: String activated: Boolean created_at: String permissions: [String] }
+//
+// movies 的参数与 GET /v1/movies 的查询参数相同，字段名与 REST 接口的 JSON 字段名相同。
+var graphqlQuery = newGraphQLSchema()
+
+// graphqlMovieList 是 Query.movies 的值。
+type graphqlMovieList struct {
+	movies   []*data.Movie
+	metadata data.Metadata
+}
+
+func newGraphQLSchema() *gqlObject {
+	rating := &gqlObject{name: "Rating", fields: map[string]*gqlField{
+		"average": {resolve: gqlProperty(func(r *data.RatingSummary) any { return r.Average })},
+		"count":   {resolve: gqlProperty(func(r *data.RatingSummary) any { return r.Count })},
+	}}
+
+	poster := &gqlObject{name: "Poster", fields: map[string]*gqlField{
+		"url":    {resolve: gqlProperty(func(p *data.Poster) any { return p.URL })},
+		"width":  {resolve: gqlProperty(func(p *data.Poster) any { return p.Width })},
+		"height": {resolve: gqlProperty(func(p *data.Poster) any { return p.Height })},
+	}}
+
+	person := &gqlObject{name: "Person", fields: map[string]*gqlField{
+		"id":         {resolve: gqlProperty(func(p *data.Person) any { return p.ID })},
+		"name":       {resolve: gqlProperty(func(p *data.Person) any { return p.Name })},
+		"birth_year": {resolve: gqlProperty(func(p *data.Person) any { return nullIfZero(p.BirthYear) })},
+	}}
+
+	credit := &gqlObject{name: "Credit", fields: map[string]*gqlField{
+		"id":        {resolve: gqlProperty(func(c *data.Credit) any { return c.ID })},
+		"role":      {resolve: gqlProperty(func(c *data.Credit) any { return c.Role })},
+		"character": {resolve: gqlProperty(func(c *data.Credit) any { return nullIfZero(c.Character) })},
+		// 演职人员是与人物一起查询出来的，不需要再次访问数据库。
+		"person": {object: person, resolve: gqlProperty(func(c *data.Credit) any { return c.Person })},
+	}}
+
+	movie := &gqlObject{name: "Movie", fields: map[string]*gqlField{
+		"id":    {resolve: gqlProperty(func(m *data.Movie) any { return m.ID })},
+		"title": {resolve: gqlProperty(func(m *data.Movie) any { return m.Title })},
+		"year":  {resolve: gqlProperty(func(m *data.Movie) any { return nullIfZero(m.Year) })},
+		"run_time": {
+			args:    map[string]string{"format": "String"},
+			resolve: resolveRunTime,
+		},
+		"genres":  {resolve: gqlProperty(func(m *data.Movie) any { return m.Genres })},
+		"version": {resolve: gqlProperty(func(m *data.Movie) any { return m.Version })},
+		"rating":  {object: rating, resolve: gqlProperty(func(m *data.Movie) any { return m.Rating })},
+		"poster":  {object: poster, resolve: gqlProperty(func(m *data.Movie) any { return m.Poster })},
+		"credits": {object: credit, access: "movies:read", cost: 1, resolve: resolveCredits},
+	}}
+
+	metadata := &gqlObject{name: "Metadata", fields: map[string]*gqlField{
+		"current_page":  {resolve: gqlProperty(func(m data.Metadata) any { return nullIfZero(m.CurrentPage) })},
+		"page_size":     {resolve: gqlProperty(func(m data.Metadata) any { return nullIfZero(m.PageSize) })},
+		"first_page":    {resolve: gqlProperty(func(m data.Metadata) any { return nullIfZero(m.FirstPage) })},
+		"last_page":     {resolve: gqlProperty(func(m data.Metadata) any { return nullIfZero(m.LastPage) })},
+		"total_records": {resolve: gqlProperty(func(m data.Metadata) any { return m.TotalRecords })},
+		"next_cursor":   {resolve: gqlProperty(func(m data.Metadata) any { return nullIfZero(m.NextCursor) })},
+		"prev_cursor":   {resolve: gqlProperty(func(m data.Metadata) any { return nullIfZero(m.PrevCursor) })},
+	}}
+
+	movieList := &gqlObject{name: "MovieList", fields: map[string]*gqlField{
+		"movies":   {object: movie, resolve: gqlProperty(func(l *graphqlMovieList) any { return l.movies })},
+		"metadata": {object: metadata, resolve: gqlProperty(func(l *graphqlMovieList) any { return l.metadata })},
+	}}
+
+	user := &gqlObject{name: "User", fields: map[string]*gqlField{
+		"id":         {resolve: gqlProperty(func(u *data.User) any { return u.ID })},
+		"name":       {resolve: gqlProperty(func(u *data.User) any { return u.Name })},
+		"email":      {resolve: gqlProperty(func(u *data.User) any { return u.Email })},
+		"activated":  {resolve: gqlProperty(func(u *data.User) any { return u.Activated })},
+		"created_at": {resolve: gqlProperty(func(u *data.User) any { return u.CreatedAt.Format(time.RFC3339) })},
+		// User 只能通过 Query.me 访问，因此这里的权限总是当前用户自己的权限。
+		"permissions": {access: accessActivated, resolve: resolvePermissions},
+	}}
+
+	return &gqlObject{name: "Query", fields: map[string]*gqlField{
+		"movie": {
+			args:    map[string]string{"id": "ID!"},
+			access:  "movies:read",
+			object:  movie,
+			cost:    1,
+			resolve: resolveMovie,
+		},
+		"movies": {
+			args: map[string]string{
+				"title": "String", "language": "String", "search_mode": "String",
+				"genres": "[String]", "genres_any": "[String]", "genres_none": "[String]",
+				"year_min": "Int", "year_max": "Int", "run_time_min": "Int", "run_time_max": "Int",
+				"created_after": "String", "created_before": "String",
+				"director": "String", "cast": "String",
+				"page": "Int", "page_size": "Int", "sort": "String", "cursor": "String",
+			},
+			access:  "movies:read",
+			object:  movieList,
+			cost:    1,
+			resolve: resolveMovies,
+		},
+		"me": {
+			access: accessActivated,
+			object: user,
+			resolve: func(req *gqlRequest, _ []any, _ map[string]any) ([]any, error) {
+				return []any{req.user}, nil
+			},
+		},
+	}}
+}
+
+func resolveMovie(req *gqlRequest, _ []any, args map[string]any) ([]any, error) {
+	movie, err := req.app.models.Movies.Get(args["id"].(int64))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return []any{nil}, nil
+		default:
+			return nil, err
+		}
+	}
+
+	return []any{movie}, nil
+}
+
+// resolveMovies() 把参数转换为查询字符串，然后使用与 listMoviesHandler() 相同的辅助函数读取和验证过滤、排序和分页参数，
+// 这样两个接口的行为和错误信息完全一致。
+func resolveMovies(req *gqlRequest, _ []any, args map[string]any) ([]any, error) {
+	app := req.app
+
+	qs := url.Values{}
+	for name, value := range args {
+		if list, ok := value.([]any); ok {
+			items := make([]string, len(list))
+			for i, item := range list {
+				items[i] = fmt.Sprint(item)
+			}
+			qs.Set(name, strings.Join(items, ","))
+			continue
+		}
+		qs.Set(name, fmt.Sprint(value))
+	}
+
+	v := validator.New()
+
+	movieFilters := app.readMovieFilters(qs, v)
+	filters := data.Filters{
+		Page:         app.readInt(qs, "page", 1, v),
+		PageSize:     app.readInt(qs, "page_size", 20, v),
+		Sort:         app.readString(qs, "sort", "id"),
+		Cursor:       app.readString(qs, "cursor", ""),
+		SortSafeList: movieSortSafeList,
+	}
+
+	genres, err := app.models.Genres.Lookup()
+	if err != nil {
+		return nil, err
+	}
+
+	data.ValidateMovieFilters(v, &movieFilters, genres)
+	if filters.Sort == "-relevance" {
+		v.Check(movieFilters.Title != "", "sort", "relevance sort requires a title search")
+		v.Check(filters.Cursor == "", "cursor", "cannot be used with relevance sort")
+	}
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		return nil, gqlValidationError(v.Errors)
+	}
+
+	movies, metadata, err := app.models.Movies.GetAll(movieFilters, filters)
+	if err != nil {
+		return nil, err
+	}
+
+	return []any{&graphqlMovieList{movies: movies, metadata: metadata}}, nil
+}
+
+func resolveRunTime(_ *gqlRequest, sources []any, args map[string]any) ([]any, error) {
+	format, _ := args["format"].(string)
+	if format == "" {
+		format = data.RunTimeMins
+	}
+
+	v := validator.New()
+	v.Check(validator.PermittedValue(format, data.RunTimeFormats...), "format", "must be one of "+strings.Join(data.RunTimeFormats, ", "))
+	if !v.Valid() {
+		return nil, gqlValidationError(v.Errors)
+	}
+
+	values := make([]any, len(sources))
+	for i, source := range sources {
+		if runTime := source.(*data.Movie).RunTime; runTime != 0 {
+			values[i] = runTime.Format(format)
+		}
+	}
+	return values, nil
+}
+
+// resolveCredits() 用一次查询加载同一层所有影片的演职人员，而不是为每部影片各查询一次。
+func resolveCredits(req *gqlRequest, sources []any, _ map[string]any) ([]any, error) {
+	ids := make([]int64, len(sources))
+	for i, source := range sources {
+		ids[i] = source.(*data.Movie).ID
+	}
+
+	credits, err := req.app.models.Credits.GetAllForMovies(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]any, len(sources))
+	for i, id := range ids {
+		if credits[id] == nil {
+			values[i] = []*data.Credit{}
+			continue
+		}
+		values[i] = credits[id]
+	}
+	return values, nil
+}
+
+func resolvePermissions(req *gqlRequest, sources []any, _ map[string]any) ([]any, error) {
+	permissions, err := req.permissions()
+	if err != nil {
+		return nil, err
+	}
+	if permissions == nil {
+		permissions = data.Permissions{}
+	}
+
+	values := make([]any, len(sources))
+	for i := range sources {
+		values[i] = permissions
+	}
+	return values, nil
+}
+
+// nullIfZero() 把零值转换为 null，对应 REST 接口中带有 omitempty 的字段。
+func nullIfZero[T comparable](value T) any {
+	var zero T
+	if value == zero {
+		return nil
+	}
+	return value
+}
@@ -11,48 +11,30 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 )
 
 func (app *application) readIDParam(r *http.Request) (int64, error) {
+	return app.readInt64Param(r, "id")
+}
+
+// readInt64Param() 从 URL 参数 name 中读取一个正整数，例如影片 ID、版本号或影评 ID。
+func (app *application) readInt64Param(r *http.Request, name string) (int64, error) {
 	// 当 httprouter 解析请求时，任何插值的 URL 参数都将存储在请求上下文中。我们可以使用 ParamsFromContext() 函数检索包含这些参数名称和值的片段。
 	params := httprouter.ParamsFromContext(r.Context())
 
-	// 然后，我们可以使用 ByName() 方法从片段中获取 "id "参数的值。在我们的项目中，所有影片都有一个唯一的正整数 ID，但 ByName() 返回的值始终是字符串。
-	// 因此，我们尝试将其转换为以 10 为底的整数（位大小为 64）。如果参数无法转换或小于 1，我们就知道 ID 无效，因此我们使用 http.NotFound() 函数返回 404 Not Found 响应。
-	id, err := strconv.ParseInt(params.ByName("id"), 10, 64)
-	if err != nil || id < 1 {
-		return 0, errors.New("invalid id parameter")
+	// 然后，我们可以使用 ByName() 方法从片段中获取参数的值。在我们的项目中，所有 ID 都是唯一的正整数，但 ByName() 返回的值始终是字符串。
+	// 因此，我们尝试将其转换为以 10 为底的整数（位大小为 64）。如果参数无法转换或小于 1，我们就知道参数无效，调用者通常会返回 404 Not Found 响应。
+	value, err := strconv.ParseInt(params.ByName(name), 10, 64)
+	if err != nil || value < 1 {
+		return 0, fmt.Errorf("invalid %s parameter", name)
 	}
 
-	return id, nil
+	return value, nil
 }
 
 type envelope map[string]any
 
-func (app *application) writeJSON(w http.ResponseWriter, status int, data envelope, headers http.Header) error {
-	// js, err := json.Marshal(data)
-
-	// 使用 json.MarshalIndent() 函数将 空格 添加到编码后的 JSON 中。在这里，我们对每个元素都不使用行前缀（""）和制表符缩进（"\t"）
-	// 方便在 命令行 请求时 查看响应json结构明确 同时 比 json.Marshal 性能要差 30%
-	// 在幕后，json.MarshalIndent() 通过正常调用 json.Marshal()，然后通过独立的 json.Indent() 函数运行 JSON 来添加空白。还有一个反向函数 json.Compact()，可以用来删除 JSON 中的空白。
-	js, err := json.MarshalIndent(data, "", "\t")
-	if err != nil {
-		return err
-	}
-
-	// 添加换行符，以便于在终端应用程序中查看。
-	js = append(js, '\n')
-
-	for key, value := range headers {
-		w.Header()[key] = value
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	w.Write(js)
-	return nil
-}
-
 func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any) error {
 	//  使用 http.MaxBytesReader() 将请求正文的大小限制为 1MB。
 	maxBytes := 1_048_576
@@ -144,6 +126,58 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 	return i
 }
 
+// readBool() helper 从查询字符串中读取布尔值，接受 strconv.ParseBool() 支持的写法（例如 true、false、1、0）。如果找不到匹配的键，则返回所提供的默认值。如果无法解析，则会在提供的 Validator 实例中记录一条错误信息。
+func (app *application) readBool(qs url.Values, key string, defaultValue bool, v *validator.Validator) bool {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return defaultValue
+	}
+	return b
+}
+
+// readIDs() helper 从查询字符串中读取以逗号分隔的 ID 列表，例如 ids=1,2,3。如果找不到匹配的键，则返回 nil。如果任何一个值不是正整数，则会在提供的 Validator 实例中记录一条错误信息。
+func (app *application) readIDs(qs url.Values, key string, v *validator.Validator) []int64 {
+	values := app.readCSV(qs, key, nil)
+	if values == nil {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(values))
+	for _, value := range values {
+		id, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil || id < 1 {
+			v.AddError(key, "must only contain positive integer values")
+			return nil
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// readTime() helper 从查询字符串中读取 RFC 3339 格式的时间（也接受 "2006-01-02" 格式的日期）。如果找不到匹配的键，则返回 nil。如果无法解析，则会在提供的 Validator 实例中记录一条错误信息。
+func (app *application) readTime(qs url.Values, key string, v *validator.Validator) *time.Time {
+	s := qs.Get(key)
+	if s == "" {
+		return nil
+	}
+
+	for _, layout := range []string{time.RFC3339, time.DateOnly} {
+		t, err := time.Parse(layout, s)
+		if err == nil {
+			return &t
+		}
+	}
+
+	v.AddError(key, "must be an RFC 3339 timestamp or a YYYY-MM-DD date")
+	return nil
+}
+
 // background() 辅助函数接受一个任意函数作为参数， recover后台程序中的 panic 错误
 func (app *application) background(fn func()) {
 	// 递增 WaitGroup 计数器。
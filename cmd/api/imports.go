@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"greenlight.311102.xyz/internal/data"
+	"greenlight.311102.xyz/internal/validator"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// importBatchSize 是每次通过 COPY 写入数据库的记录数。
+const importBatchSize = 500
+
+// maxImportErrors 是导入报告中最多列出的被拒绝的行数，超出的部分只计入 ErrorsTruncated，避免一个很大的错误文件产生同样大的响应。
+const maxImportErrors = 1000
+
+// importLineError 记录导入时被拒绝的某一行以及拒绝的原因。
+type importLineError struct {
+	Line   int               `json:"line"`
+	Errors map[string]string `json:"errors"`
+}
+
+// importReport 是导入的结果。导入中途失败时同样会返回这个报告：FailedLine 是导入停止的位置，它之前的记录都已经处理完毕
+// （写入的记录计入 Accepted），之后的记录都没有写入，因此客户端可以从这一行开始重试，而不会产生重复的影片。
+// Errors 只包含前 maxImportErrors 个被拒绝的行，ErrorsTruncated 是没有列出的行数。
+type importReport struct {
+	Accepted        int               `json:"accepted"`
+	Rejected        int               `json:"rejected"`
+	Errors          []importLineError `json:"errors"`
+	ErrorsTruncated int               `json:"errors_truncated,omitempty"`
+	FailedLine      int               `json:"failed_line,omitempty"`
+}
+
+// movieRecordFunc 会在读取到每一条记录时被调用。errs 中包含解析记录时遇到的错误；如果记录完全无法解析，movie 为 nil。
+type movieRecordFunc func(line int, movie *data.Movie, errs map[string]string) error
+
+func (app *application) importMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		app.unsupportedMediaTypeResponse(w, r)
+		return
+	}
+
+	var readRecords func(body io.Reader, fn movieRecordFunc) error
+	switch mediaType {
+	case "application/x-ndjson", "application/ndjson":
+		readRecords = readMoviesNDJSON
+	case "text/csv":
+		readRecords = readMoviesCSV
+	default:
+		app.unsupportedMediaTypeResponse(w, r)
+		return
+	}
+
+	// 导入的请求体可能非常大，服务器默认的读写超时时间不足以完成整个导入，因此单独为这个请求延长期限。
+	// metricsResponseWriter 实现了 Unwrap() 方法，所以 ResponseController 可以找到底层的 http.ResponseWriter。
+	rc := http.NewResponseController(w)
+	deadline := time.Now().Add(10 * time.Minute)
+	if err := rc.SetReadDeadline(deadline); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if err := rc.SetWriteDeadline(deadline); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// 与 readJSON() 不同，这里允许最大 256MB 的请求体，并且是边读边处理的，不会把整个请求体读入内存。
+	maxBytes := 268_435_456
+	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
+
+	// 类型表在整个导入过程中只加载一次。
+	genres, err := app.models.Genres.Lookup()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	userID := app.contextGetUser(r).ID
+
+	report := importReport{Errors: []importLineError{}}
+	batch := make([]*data.Movie, 0, importBatchSize)
+	// batchStart 是当前批次中第一条记录所在的行，lastLine 是最后读取到的一行。
+	var batchStart, lastLine int
+
+	// 每个批次在独立的事务中写入。如果导入中途失败，之前已经写入的批次会被保留，并在报告中说明。
+	var insertErr error
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		insertErr = app.models.Movies.InsertMany(batch, userID)
+		if insertErr != nil {
+			report.FailedLine = batchStart
+			return insertErr
+		}
+		report.Accepted += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+
+	err = readRecords(r.Body, func(line int, movie *data.Movie, errs map[string]string) error {
+		lastLine = line
+
+		// 先放入解析错误，AddError() 不会覆盖已存在的键，所以同一字段只会报告解析错误。
+		v := validator.New()
+		for key, message := range errs {
+			v.AddError(key, message)
+		}
+		if movie != nil {
+			data.ValidateMovie(v, movie, genres)
+		}
+
+		if !v.Valid() {
+			report.Rejected++
+			if len(report.Errors) < maxImportErrors {
+				report.Errors = append(report.Errors, importLineError{Line: line, Errors: v.Errors})
+			} else {
+				report.ErrorsTruncated++
+			}
+			return nil
+		}
+
+		if len(batch) == 0 {
+			batchStart = line
+		}
+		batch = append(batch, movie)
+		if len(batch) == importBatchSize {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil && insertErr == nil {
+		// 请求体无法继续读取时，先写入已经读取的记录，这样 failed_line 之前的记录都已经处理完毕。
+		report.FailedLine = lastLine + 1
+		if flushErr := flush(); flushErr != nil {
+			err = flushErr
+		}
+	} else if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+
+		switch {
+		case insertErr != nil:
+			app.logError(r, err)
+			app.importErrorResponse(w, r, http.StatusInternalServerError, "the server encountered a problem and could not process your request", report)
+		case errors.As(err, &maxBytesError):
+			app.importErrorResponse(w, r, http.StatusBadRequest, fmt.Sprintf("body must not be larger than %d bytes", maxBytesError.Limit), report)
+		default:
+			app.importErrorResponse(w, r, http.StatusBadRequest, err.Error(), report)
+		}
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"import": report}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// importErrorResponse() 发送导入失败的错误信息，并附上到失败为止的导入报告，客户端可以据此得知哪些记录已经写入。
+func (app *application) importErrorResponse(w http.ResponseWriter, r *http.Request, status int, message string, report importReport) {
+	err := app.writeResponse(w, r, status, envelope{"error": message, "import": report}, nil)
+	if err != nil {
+		app.logError(r, err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// readMoviesNDJSON() 逐行读取 NDJSON 请求体，每一行都是一个与 createMovieHandler 请求体格式相同的 JSON 对象。空行会被忽略。
+func readMoviesNDJSON(body io.Reader, fn movieRecordFunc) error {
+	scanner := bufio.NewScanner(body)
+	// 单行最大允许 1MB，与 readJSON() 对单个请求体的限制保持一致。
+	scanner.Buffer(make([]byte, 0, 64*1024), 1_048_576)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+
+		b := bytes.TrimSpace(scanner.Bytes())
+		if len(b) == 0 {
+			continue
+		}
+
+		var input createMovieInput
+
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.DisallowUnknownFields()
+
+		err := dec.Decode(&input)
+		if err == nil && dec.More() {
+			err = errors.New("line must only contain a single JSON value")
+		}
+		if err != nil {
+			err = fn(line, nil, map[string]string{"record": err.Error()})
+		} else {
+			err = fn(line, &data.Movie{
+				Title:   input.Title,
+				Year:    input.Year,
+				RunTime: input.RunTime,
+				Genres:  input.Genres,
+			}, nil)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return fmt.Errorf("line %d is longer than 1048576 bytes", line+1)
+		}
+		return err
+	}
+	return nil
+}
+
+// readMoviesCSV() 读取 CSV 请求体。第一行必须是包含 title、year、run_time 和 genres 列的表头（顺序不限），
+// run_time 可以是整数分钟数或者 "<runtime> mins" 格式，genres 列中的多个类型之间使用逗号分隔（需要用双引号包围该字段）。
+func readMoviesCSV(body io.Reader, fn movieRecordFunc) error {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return errors.New("body must not be empty")
+		}
+		return err
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"title", "year", "run_time", "genres"} {
+		if _, ok := columns[name]; !ok {
+			return fmt.Errorf("header must contain a %q column", name)
+		}
+	}
+
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		// csv.ParseError 表示某一行格式有误，记录下来后继续读取下一行。
+		var parseError *csv.ParseError
+		if errors.As(err, &parseError) {
+			err = fn(parseError.StartLine, nil, map[string]string{"record": parseError.Err.Error()})
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		line, _ := reader.FieldPos(0)
+
+		field := func(name string) string {
+			i := columns[name]
+			if i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+
+		errs := make(map[string]string)
+		movie := &data.Movie{Title: field("title")}
+
+		if s := field("year"); s != "" {
+			year, err := strconv.ParseInt(s, 10, 32)
+			if err != nil {
+				errs["year"] = "must be an integer value"
+			}
+			movie.Year = int32(year)
+		}
+
+		if s := field("run_time"); s != "" {
+			runTime, err := data.ParseRunTime(s)
+			if err != nil {
+				errs["run_time"] = err.Error()
+			}
+			movie.RunTime = runTime
+		}
+
+		if s := field("genres"); s != "" {
+			movie.Genres = []string{}
+			for _, genre := range strings.Split(s, ",") {
+				movie.Genres = append(movie.Genres, strings.TrimSpace(genre))
+			}
+		}
+
+		err = fn(line, movie, errs)
+		if err != nil {
+			return err
+		}
+	}
+}
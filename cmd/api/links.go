@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"greenlight.311102.xyz/internal/data"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// link 是一个 RFC 8288 Web 链接。Href 是相对于当前请求的 URI 引用（只包含路径和查询字符串），与 Location 标头的写法一致。
+type link struct {
+	Rel  string
+	Href string
+}
+
+// paginationLinks() 根据分页元数据生成 first、prev、next 和 last 链接。链接保留原请求的所有查询参数，只替换 page 和 cursor。
+// 使用页码分页时生成全部四个链接（在第一页和最后一页时分别省略 prev 和 next）；使用游标分页时无法得知总页数，
+// 因此没有 last，first 指向不带游标的第一页，prev 和 next 使用元数据中的游标。结果为空时不生成任何链接。
+func paginationLinks(r *http.Request, metadata data.Metadata) []link {
+	qs := r.URL.Query()
+
+	href := func(key, value string) string {
+		u := *r.URL
+		q := u.Query()
+		q.Del("page")
+		q.Del("cursor")
+		if key != "" {
+			q.Set(key, value)
+		}
+		u.RawQuery = q.Encode()
+		return u.RequestURI()
+	}
+
+	var links []link
+
+	if qs.Get("cursor") != "" {
+		if metadata.NextCursor == "" && metadata.PrevCursor == "" {
+			return nil
+		}
+
+		links = append(links, link{"first", href("", "")})
+		if metadata.PrevCursor != "" {
+			links = append(links, link{"prev", href("cursor", metadata.PrevCursor)})
+		}
+		if metadata.NextCursor != "" {
+			links = append(links, link{"next", href("cursor", metadata.NextCursor)})
+		}
+		return links
+	}
+
+	if metadata.LastPage == 0 {
+		return nil
+	}
+
+	page := func(n int) string {
+		return href("page", strconv.Itoa(n))
+	}
+
+	links = append(links, link{"first", page(metadata.FirstPage)})
+	if metadata.CurrentPage > metadata.FirstPage {
+		links = append(links, link{"prev", page(min(metadata.CurrentPage-1, metadata.LastPage))})
+	}
+	if metadata.CurrentPage < metadata.LastPage {
+		links = append(links, link{"next", page(metadata.CurrentPage + 1)})
+	}
+	links = append(links, link{"last", page(metadata.LastPage)})
+
+	return links
+}
+
+// linkHeader() 把链接编码为 Link 标头的值，例如 </v1/movies?page=2>; rel="next", </v1/movies?page=5>; rel="last"。
+func linkHeader(links []link) string {
+	values := make([]string, 0, len(links))
+	for _, l := range links {
+		values = append(values, fmt.Sprintf(`<%s>; rel="%s"`, l.Href, l.Rel))
+	}
+	return strings.Join(values, ", ")
+}
+
+// linksObject() 把链接转换为 HAL 风格的 _links 对象，例如 {"self": {"href": "/v1/movies"}, "next": {"href": "/v1/movies?page=2"}}。
+func linksObject(r *http.Request, links []link) map[string]map[string]string {
+	object := map[string]map[string]string{"self": {"href": r.URL.RequestURI()}}
+	for _, l := range links {
+		object[l.Rel] = map[string]string{"href": l.Href}
+	}
+	return object
+}
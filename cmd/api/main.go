@@ -7,9 +7,11 @@ import (
 	"flag"
 	"fmt"
 	_ "github.com/lib/pq"
+	"greenlight.311102.xyz/internal/cache"
 	"greenlight.311102.xyz/internal/data"
 	"greenlight.311102.xyz/internal/jsonlog"
 	"greenlight.311102.xyz/internal/mailer"
+	"greenlight.311102.xyz/internal/storage"
 	"greenlight.311102.xyz/internal/vcs"
 	"os"
 	"runtime"
@@ -46,14 +48,40 @@ type config struct {
 	cors struct {
 		trustedOrigins []string
 	}
+	// 回收站中的影片保留的时长，以及清理任务的运行间隔。
+	trash struct {
+		retention     time.Duration
+		purgeInterval time.Duration
+	}
+	// 上传文件（例如海报）的保存目录，以及客户端访问这些文件时使用的地址前缀。
+	storage struct {
+		dir     string
+		baseURL string
+	}
+	// 影片统计结果的缓存时长和最多缓存的条目数量。
+	stats struct {
+		cacheTTL  time.Duration
+		cacheSize int
+	}
+	// 是否在请求到达处理程序之前，按照 OpenAPI 文档检查查询参数和请求体。
+	openapi struct {
+		validate bool
+	}
 }
 
 type application struct {
-	config config
-	logger *jsonlog.Logger // 将日志记录器字段改为 *jsonlog.Logger 类型，而不是 log.Logger。
-	models data.Models
-	mailer mailer.Mailer
-	wg     sync.WaitGroup // 在应用程序结构体中加入 sync.WaitGroup。sync.WaitGroup 类型的零值是一个有效的、可使用的、"计数器 "值为 0 的 sync.WaitGroup，因此我们在使用它之前不需要做任何其他初始化操作。
+	config  config
+	logger  *jsonlog.Logger // 将日志记录器字段改为 *jsonlog.Logger 类型，而不是 log.Logger。
+	models  data.Models
+	mailer  mailer.Mailer
+	storage storage.Storage
+	// 以过滤条件为键缓存 GET /v1/stats/movies 的结果。
+	statsCache *cache.TTL[*data.MovieStats]
+	// routes() 生成的 OpenAPI 文档，由 GET /v1/openapi.json 返回。
+	openapi envelope
+	// 服务器开始关闭时关闭这个通道，通知长期运行的后台程序（例如回收站清理）退出。
+	shutdown chan struct{}
+	wg       sync.WaitGroup // 在应用程序结构体中加入 sync.WaitGroup。sync.WaitGroup 类型的零值是一个有效的、可使用的、"计数器 "值为 0 的 sync.WaitGroup，因此我们在使用它之前不需要做任何其他初始化操作。
 }
 
 func main() {
@@ -89,6 +117,17 @@ func main() {
 		return nil
 	})
 
+	flag.DurationVar(&cfg.trash.retention, "trash-retention", 30*24*time.Hour, "How long deleted movies are kept in the trash (0 keeps them forever)")
+	flag.DurationVar(&cfg.trash.purgeInterval, "trash-purge-interval", time.Hour, "Interval between trash purge runs (0 disables purging)")
+
+	flag.StringVar(&cfg.storage.dir, "storage-dir", "./uploads", "Directory for uploaded files")
+	flag.StringVar(&cfg.storage.baseURL, "storage-base-url", "/v1/uploads", "Base URL for uploaded files")
+
+	flag.DurationVar(&cfg.stats.cacheTTL, "stats-cache-ttl", time.Minute, "How long movie statistics are cached (0 disables caching)")
+	flag.IntVar(&cfg.stats.cacheSize, "stats-cache-size", 1000, "Maximum number of cached movie statistics results")
+
+	flag.BoolVar(&cfg.openapi.validate, "openapi-validate", false, "Reject requests that do not match the OpenAPI document")
+
 	displayVersion := flag.Bool("version", false, "Display version and exit")
 
 	flag.Parse()
@@ -128,14 +167,26 @@ func main() {
 	expvar.Publish("timestamp", expvar.Func(func() any {
 		return time.Now().Unix()
 	}))
+	// 目前只有本地文件系统一种存储实现。
+	store, err := storage.NewLocal(cfg.storage.dir, cfg.storage.baseURL)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
 	// 使用 data.NewModels() 函数初始化一个 Models 结构，并将连接池作为参数传递。
 	app := &application{
-		config: cfg,
-		logger: logger,
-		models: data.NewModels(db),
-		mailer: mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
+		config:     cfg,
+		logger:     logger,
+		models:     data.NewModels(db),
+		mailer:     mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
+		storage:    store,
+		statsCache: cache.New[*data.MovieStats](cfg.stats.cacheTTL, cfg.stats.cacheSize),
+		shutdown:   make(chan struct{}),
 	}
 
+	// 启动定期清理回收站的后台任务。
+	app.purgeTrash()
+
 	err = app.serve()
 	if err != nil {
 		logger.PrintFatal(err, nil)
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"greenlight.311102.xyz/internal/data"
+	"greenlight.311102.xyz/internal/validator"
+	"net/http"
+)
+
+// mergeMovieInput 是 POST /v1/movies/:id/merge 的请求体。
+type mergeMovieInput struct {
+	Into int64 `json:"into"`
+}
+
+// mergeMovieHandler 把 URL 中的重复影片合并到 into 指定的影片中。合并之后重复影片被删除，它的 ID 会重定向到保留下来的影片。
+func (app *application) mergeMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input mergeMovieInput
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	runTimeFormat := app.readRunTimeFormat(r, v)
+	v.Check(input.Into > 0, "into", "must be provided")
+	v.Check(input.Into != id, "into", "must be a different movie")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// 保留的影片不存在属于请求内容的问题，因此返回 422；URL 中的影片不存在则返回 404。
+	_, err = app.models.Movies.Get(input.Into)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("into", "must refer to an existing movie")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	poster, err := app.models.Movies.Merge(id, input.Into, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// 重复的影片已经被删除，不再有任何记录引用它的海报文件。删除失败不影响合并的结果，只记录日志。
+	for _, key := range posterKeys(id, poster) {
+		err = app.storage.Delete(key)
+		if err != nil {
+			app.logError(r, err)
+		}
+	}
+
+	// 重新读取保留的影片，它的评分等汇总信息已经包含了合并进来的记录。
+	movie, err := app.models.Movies.Get(input.Into)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", formatETag(movieETag(movie), runTimeFormat))
+
+	resource, err := app.shapeMovie(movie, nil, nil, runTimeFormat)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"movie": resource}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// redirectMergedMovie() 如果 id 是已经被合并的影片，发送 301 响应，把客户端重定向到保留下来的影片（保留原来的查询参数），否则发送 404 响应。
+func (app *application) redirectMergedMovie(w http.ResponseWriter, r *http.Request, id int64) {
+	targetID, err := app.models.Movies.Redirect(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	location := *r.URL
+	location.Path = fmt.Sprintf("/v1/movies/%d", targetID)
+
+	headers := make(http.Header)
+	headers.Set("Location", location.RequestURI())
+
+	err = app.writeResponse(w, r, http.StatusMovedPermanently, envelope{"message": "this movie has been merged into another movie", "movie_id": targetID}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -4,18 +4,25 @@ import (
 	"errors"
 	"fmt"
 	"greenlight.311102.xyz/internal/data"
+	"greenlight.311102.xyz/internal/jsonpatch"
 	"greenlight.311102.xyz/internal/validator"
 	"net/http"
-	"strconv"
+	"net/url"
 )
 
+// movieSortSafeList 是影片列表和导出接口允许使用的排序参数。-relevance 按标题搜索的相关度从高到低排序，只能与 title 参数一起使用。
+var movieSortSafeList = []string{"id", "title", "year", "run_time", "-id", "-title", "-year", "-run_time", "-relevance"}
+
+// createMovieInput 是 POST /v1/movies 的请求体。
+type createMovieInput struct {
+	Title   string       `json:"title"`
+	Year    int32        `json:"year"`
+	RunTime data.RunTime `json:"run_time"`
+	Genres  []string     `json:"genres"`
+}
+
 func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Request) {
-	var input struct {
-		Title   string       `json:"title"`
-		Year    int32        `json:"year"`
-		RunTime data.RunTime `json:"run_time"`
-		Genres  []string     `json:"genres"`
-	}
+	var input createMovieInput
 	// json.Unmarshal() 比 json.Decoder 多用 80% 内存 且更慢一些
 	// err := json.NewDecoder(r.Body).Decode(&input)
 
@@ -32,14 +39,37 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 		Genres:  input.Genres,
 	}
 
+	genres, err := app.models.Genres.Lookup()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
 	v := validator.New()
 
-	if data.ValidateMovie(v, movie); !v.Valid() {
+	runTimeFormat := app.readRunTimeFormat(r, v)
+	allowDuplicate := app.readBool(r.URL.Query(), "allow_duplicate", false, v)
+
+	if data.ValidateMovie(v, movie, genres); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	err = app.models.Movies.Insert(movie)
+	// 除非客户端明确表示允许，否则标题和年份与已有影片相同（或非常接近）的影片不会被创建，而是返回可能重复的影片。
+	// 这只是一个尽力而为的检查，并发的创建请求仍然可能产生重复的影片，此时可以使用 POST /v1/movies/:id/merge 合并它们。
+	if !allowDuplicate {
+		candidates, err := app.models.Movies.FindDuplicates(movie)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if len(candidates) > 0 {
+			app.duplicateMovieResponse(w, r, candidates)
+			return
+		}
+	}
+
+	err = app.models.Movies.Insert(movie, app.contextGetUser(r).ID)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -50,8 +80,14 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 	headers := make(http.Header)
 	headers.Set("Location", fmt.Sprintf("/v1/movies/%d", movie.ID))
 
+	resource, err := app.shapeMovie(movie, nil, nil, runTimeFormat)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
 	// 编写一个 JSON 响应，状态代码为 201 "已创建"，在响应正文中包含影片数据和位置标头。
-	err = app.writeJSON(w, http.StatusCreated, envelope{"movie": movie}, headers)
+	err = app.writeResponse(w, r, http.StatusCreated, envelope{"movie": resource}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -64,18 +100,57 @@ func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	movie, err := app.models.Movies.Get(id)
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	fields := app.readCSV(qs, "fields", []string{})
+	include := app.readCSV(qs, "include", []string{})
+	runTimeFormat := app.readRunTimeFormat(r, v)
+
+	data.ValidateFields(v, fields, movieFieldSafeList)
+	if validateInclude(v, include); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	movie, err := app.models.Movies.Get(id, fields...)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
-			app.notFoundResponse(w, r)
+			// 影片可能已经被合并到另一部影片中。
+			app.redirectMergedMovie(w, r, id)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
+	resource, err := app.shapeMovie(movie, fields, include, runTimeFormat)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// 嵌入的关联资源变化时影片的版本号不会变化，所以 include 不为空时还要在 ETag 中追加响应内容的摘要。
+	// 追加之后它仍然是以版本号开头的强 ETag，客户端依然可以把它用在 If-Match 中。
+	etag := formatETag(movieETag(movie), runTimeFormat)
+	if len(include) > 0 {
+		hash, err := contentHash(resource)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		etag = appendETag(etag, hash)
+	}
+
+	// 客户端缓存的版本仍然是最新的，直接返回 304 Not Modified。
+	env := envelope{"movie": resource}
+	if app.notModified(w, r, etag, env) {
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, env, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -98,66 +173,59 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	// 如果请求包含 X-Expected-Version 标头，则要验证数据库中的电影版本是否与标头中指定的预期版本一致。
-	if r.Header.Get("X-Expected-Version") != "" {
-		// FormatInt 返回 i 以给定基数表示的字符串，2 <= 基数 <= 36。对于大于等于 10 的数字值，结果使用小写字母 "a "至 "z "表示。
-		if strconv.FormatInt(int64(movie.Version), 32) != r.Header.Get("X-Expected-Version") {
-			app.editConflictResponse(w, r)
-			return
-		}
-	}
-
-	// 为了实现 按需修改 而不是 次次 都完全替换 即 将 put 替换成 patch
-	// 因为普通值传递类型 当json解析时候 字段不存在传值时直接将其赋值未该值类型的 0 值  无法区分 缺少字段直接报错 还是未传值 对字段不进行修改
-	// 所以将值传递类型 改为存储指针 对 genres 切片 类型则无需处理 若修改提交上来的 json 数据中缺少某个 字段 则为 nil
-	var input struct {
-		Title   *string       `json:"title"`
-		Year    *int32        `json:"year"`
-		RunTime *data.RunTime `json:"run_time"`
-		Genres  []string      `json:"genres"`
+	// 检查 If-Match（以及旧的 X-Expected-Version）标头，确保客户端是在最新版本的基础上进行修改的。
+	if !app.checkMoviePreconditions(w, r, movie) {
+		return
 	}
 
-	err = app.readJSON(w, r, &input)
+	// 根据 Content-Type 读取客户端提交的修改，并将其应用到 movie 上。
+	err = app.readMovieChanges(w, r, movie)
 	if err != nil {
-		app.badRequestResponse(w, r, err)
+		switch {
+		case errors.Is(err, jsonpatch.ErrTestFailed):
+			app.patchTestFailedResponse(w, r, err)
+		default:
+			app.badRequestResponse(w, r, err)
+		}
 		return
 	}
 
-	if input.Title != nil {
-		movie.Title = *input.Title
-	}
-
-	if input.Year != nil {
-		movie.Year = *input.Year
-	}
-
-	if input.RunTime != nil {
-		movie.RunTime = *input.RunTime
-	}
-
-	if input.Genres != nil {
-		movie.Genres = input.Genres
+	genres, err := app.models.Genres.Lookup()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
 	}
 
 	// 验证更新的电影记录，如果任何检查失败，则向客户端发送 422 不可处理实体响应。
 	v := validator.New()
-	if data.ValidateMovie(v, movie); !v.Valid() {
+	runTimeFormat := app.readRunTimeFormat(r, v)
+	if data.ValidateMovie(v, movie, genres); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	err = app.models.Movies.Update(movie)
+	err = app.models.Movies.Update(movie, app.contextGetUser(r).ID)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrEditConflict):
-			app.editConflictResponse(w, r)
+			app.movieEditConflictResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
+	resource, err := app.shapeMovie(movie, nil, nil, runTimeFormat)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// 在响应中返回新版本的 ETag，客户端可以直接用它进行下一次修改。
+	headers := make(http.Header)
+	headers.Set("ETag", formatETag(movieETag(movie), runTimeFormat))
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"movie": resource}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -169,18 +237,41 @@ func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Reques
 		app.serverErrorResponse(w, r, err)
 		return
 	}
-	err = app.models.Movies.Delete(id)
+
+	// 只有客户端提供了前置条件时才需要先读取影片，此时删除操作也会检查版本号，避免在检查之后影片又被修改。
+	var version int32
+	if r.Header.Get("If-Match") != "" || r.Header.Get("X-Expected-Version") != "" {
+		movie, err := app.models.Movies.Get(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		if !app.checkMoviePreconditions(w, r, movie) {
+			return
+		}
+		version = movie.Version
+	}
+
+	err = app.models.Movies.Delete(id, version)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
 			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.movieEditConflictResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"message": "movie successfully deleted"}, nil)
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"message": "movie successfully moved to trash"}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -189,8 +280,11 @@ func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Reques
 func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request) {
 	// 为了与其他处理程序保持一致，我们将定义一个输入结构来保存来自请求查询字符串的预期值。
 	var input struct {
-		Title  string
-		Genres []string
+		Facets        []string
+		Include       []string
+		RunTimeFormat string
+		Links         bool
+		data.MovieFilters
 		data.Filters
 	}
 
@@ -198,32 +292,123 @@ func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request
 
 	qs := r.URL.Query()
 
-	// 使用我们的助手提取标题和基因查询字符串值，如果客户端没有提供，则分别返回默认的空字符串和空片段值
-	input.Title = app.readString(qs, "title", "")
-	input.Genres = app.readCSV(qs, "genres", []string{})
+	// 提供了 ids 参数时按 ID 批量读取影片，此时不使用过滤、排序和分页参数。
+	if qs.Has("ids") {
+		app.writeMovieBatch(w, r, app.readIDs(qs, "ids", v), v)
+		return
+	}
+
+	input.MovieFilters = app.readMovieFilters(qs, v)
+	// 读取需要统计的分面，例如 facets=genres,decade。未提供时不做任何统计。
+	input.Facets = app.readCSV(qs, "facets", []string{})
 	input.Filters.Page = app.readInt(qs, "page", 1, v)
 	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
 	// 提取排序查询字符串值，如果客户端未提供，则返回到 "id"（这意味着将根据影片 ID 升序排序）。
 	input.Filters.Sort = app.readString(qs, "sort", "id")
-
-	input.Filters.SortSafeList = []string{"id", "title", "year", "run_time", "-id", "-title", "-year", "-run_time"}
+	// 读取游标查询字符串值。客户端提供游标时将使用键集分页，此时 page 参数会被忽略。
+	input.Filters.Cursor = app.readString(qs, "cursor", "")
+
+	input.Filters.SortSafeList = movieSortSafeList
+	// 读取稀疏字段集和需要嵌入的关联资源，例如 fields=id,title&include=revisions。
+	input.Filters.Fields = app.readCSV(qs, "fields", []string{})
+	input.Filters.FieldSafeList = movieFieldSafeList
+	input.Include = app.readCSV(qs, "include", []string{})
+	input.RunTimeFormat = app.readRunTimeFormat(r, v)
+	// links=true 时在响应中嵌入 _links 对象，分页链接总是通过 Link 标头返回。
+	input.Links = app.readBool(qs, "links", false, v)
+
+	genres, err := app.models.Genres.Lookup()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
 
 	// 检查验证器实例是否有任何错误，必要时使用 failedValidationResponse() 助手向客户端发送响应。
+	data.ValidateMovieFilters(v, &input.MovieFilters, genres)
+	data.ValidateFacets(v, input.Facets)
+	validateInclude(v, input.Include)
+	if input.Filters.Sort == "-relevance" {
+		v.Check(input.MovieFilters.Title != "", "sort", "relevance sort requires a title search")
+		v.Check(input.Filters.Cursor == "", "cursor", "cannot be used with relevance sort")
+	}
 	if data.ValidateFilters(v, input.Filters); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	movies, metadata, err := app.models.Movies.GetAll(input.Title, input.Genres, input.Filters)
+	movies, metadata, err := app.models.Movies.GetAll(input.MovieFilters, input.Filters)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"movies": movies, "metadata": metadata}, nil)
+	env := envelope{"metadata": metadata}
+
+	// 分面统计针对的是整个过滤结果而不是当前页，因此作为与 metadata 并列的 facets 键返回。
+	var facets data.Facets
+	if len(input.Facets) > 0 {
+		facets, err = app.models.Movies.Facets(input.MovieFilters, input.Facets)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		env["facets"] = facets
+	}
+
+	env["movies"], err = app.shapeMovies(movies, input.Filters.Fields, input.Include, input.RunTimeFormat)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	etag := formatETag(moviesETag(movies, metadata, facets), input.RunTimeFormat)
+	if len(input.Include) > 0 {
+		etag, err = contentETag(env)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	if app.notModified(w, r, etag, env) {
+		return
+	}
+
+	// 客户端可以直接跟随 Link 标头中的 first、prev、next 和 last 链接翻页，而无需自己根据元数据拼接 URL。
+	links := paginationLinks(r, metadata)
+	headers := make(http.Header)
+	if len(links) > 0 {
+		headers.Set("Link", linkHeader(links))
+	}
+	if input.Links {
+		env["_links"] = linksObject(r, links)
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, env, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 	// 注意，%+v 会输出字段名和相应的值，而 "\n" 则是一个换行符，使输出更易读。
 	// fmt.Fprintf(w, "%+v\n", input)
 }
+
+// readMovieFilters() 从查询字符串中读取影片列表和导出接口共用的过滤条件。
+func (app *application) readMovieFilters(qs url.Values, v *validator.Validator) data.MovieFilters {
+	return data.MovieFilters{
+		// 使用我们的助手提取标题和基因查询字符串值，如果客户端没有提供，则分别返回默认的空字符串和空片段值
+		Title:         app.readString(qs, "title", ""),
+		Language:      app.readString(qs, "language", ""),
+		SearchMode:    app.readString(qs, "search_mode", ""),
+		Genres:        app.readCSV(qs, "genres", []string{}),
+		GenresAny:     app.readCSV(qs, "genres_any", []string{}),
+		GenresNone:    app.readCSV(qs, "genres_none", []string{}),
+		YearMin:       app.readInt(qs, "year_min", 0, v),
+		YearMax:       app.readInt(qs, "year_max", 0, v),
+		RunTimeMin:    app.readInt(qs, "run_time_min", 0, v),
+		RunTimeMax:    app.readInt(qs, "run_time_max", 0, v),
+		CreatedAfter:  app.readTime(qs, "created_after", v),
+		CreatedBefore: app.readTime(qs, "created_before", v),
+		Director:      app.readString(qs, "director", ""),
+		Cast:          app.readString(qs, "cast", ""),
+	}
+}
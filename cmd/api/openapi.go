@@ -0,0 +1,449 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"greenlight.311102.xyz/internal/data"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// operation 描述一个端点的请求和响应，用于生成 OpenAPI 文档以及检查请求。
+// Body 和 Response 是普通的 Go 值，文档中的 schema 通过反射它们的类型生成，因此与处理程序实际编码的 JSON 保持一致。
+type operation struct {
+	ID       string
+	Summary  string
+	Query    []*openAPIParameter
+	Body     any                    // JSON 请求体的类型，通常与处理程序中的 input 结构体相同；nil 表示没有 JSON 请求体
+	Consumes map[string]*jsonSchema // JSON 以外的请求体媒体类型，例如 text/csv
+	Status   int                    // 成功时的状态码，默认为 200
+	Response any                    // 成功时的响应体（通常是 envelope）的类型；nil 表示响应体不是 JSON
+	Produces []string               // JSON 以外的响应媒体类型，例如导出时的 text/csv
+	Extra    []int                  // 除了根据访问要求、路径参数和请求内容推断出的错误之外，该端点还可能返回的状态码
+}
+
+// jsonSchema 是 OpenAPI 3.0 中 Schema Object 的子集。
+type jsonSchema struct {
+	Ref                  string                 `json:"$ref,omitempty"`
+	Type                 string                 `json:"type,omitempty"`
+	Format               string                 `json:"format,omitempty"`
+	Description          string                 `json:"description,omitempty"`
+	Nullable             bool                   `json:"nullable,omitempty"`
+	Enum                 []string               `json:"enum,omitempty"`
+	Default              any                    `json:"default,omitempty"`
+	Minimum              *int                   `json:"minimum,omitempty"`
+	Maximum              *int                   `json:"maximum,omitempty"`
+	Items                *jsonSchema            `json:"items,omitempty"`
+	Properties           map[string]*jsonSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties any                    `json:"additionalProperties,omitempty"` // *jsonSchema 或 false
+	OneOf                []*jsonSchema          `json:"oneOf,omitempty"`
+}
+
+type openAPIParameter struct {
+	Name        string      `json:"name"`
+	In          string      `json:"in"`
+	Description string      `json:"description,omitempty"`
+	Required    bool        `json:"required,omitempty"`
+	Style       string      `json:"style,omitempty"`
+	Explode     *bool       `json:"explode,omitempty"`
+	Schema      *jsonSchema `json:"schema"`
+}
+
+type openAPIMediaType struct {
+	Schema *jsonSchema `json:"schema"`
+}
+
+type openAPIRequestBody struct {
+	Required bool                        `json:"required"`
+	Content  map[string]openAPIMediaType `json:"content"`
+}
+
+type openAPIResponse struct {
+	Ref         string                      `json:"$ref,omitempty"`
+	Description string                      `json:"description,omitempty"`
+	Content     map[string]openAPIMediaType `json:"content,omitempty"`
+}
+
+type openAPIOperation struct {
+	OperationID string                      `json:"operationId"`
+	Summary     string                      `json:"summary"`
+	Description string                      `json:"description,omitempty"`
+	Tags        []string                    `json:"tags"`
+	Parameters  []*openAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *openAPIRequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*openAPIResponse `json:"responses"`
+	Security    []map[string][]string       `json:"security,omitempty"`
+	Permission  string                      `json:"x-permission,omitempty"`
+}
+
+// errorResponses 是通用的错误响应，文档中以 #/components/responses/<名称> 引用。它们的响应体都是 {"error": ...}。
+var errorResponses = map[int]string{
+	http.StatusBadRequest:           "BadRequest",
+	http.StatusUnauthorized:         "Unauthorized",
+	http.StatusForbidden:            "Forbidden",
+	http.StatusNotFound:             "NotFound",
+	http.StatusConflict:             "Conflict",
+	http.StatusPreconditionFailed:   "PreconditionFailed",
+	http.StatusUnsupportedMediaType: "UnsupportedMediaType",
+	http.StatusUnprocessableEntity:  "FailedValidation",
+	http.StatusTooManyRequests:      "RateLimitExceeded",
+	http.StatusInternalServerError:  "ServerError",
+}
+
+// openAPIDocument() 为 routes() 中注册的端点生成 OpenAPI 3.0 文档。与 httprouter 注册冲突的路由一样，生成失败属于编程错误，因此直接 panic。
+func openAPIDocument(endpoints []endpoint) envelope {
+	g := newSchemaGenerator()
+	g.components["Error"] = &jsonSchema{
+		Type: "object",
+		Properties: map[string]*jsonSchema{
+			"error": {
+				Description: "Error message, or an object keyed by field name when validation fails",
+				OneOf: []*jsonSchema{
+					{Type: "string"},
+					{Type: "object", AdditionalProperties: &jsonSchema{Type: "string"}},
+				},
+			},
+		},
+		Required: []string{"error"},
+	}
+
+	responses := make(map[string]*openAPIResponse, len(errorResponses))
+	for status, name := range errorResponses {
+		responses[name] = &openAPIResponse{
+			Description: http.StatusText(status),
+			Content:     map[string]openAPIMediaType{"application/json": {Schema: &jsonSchema{Ref: "#/components/schemas/Error"}}},
+		}
+	}
+
+	paths := make(map[string]map[string]*openAPIOperation)
+	for _, e := range endpoints {
+		path, params := openAPIPath(e.path)
+		if paths[path] == nil {
+			paths[path] = make(map[string]*openAPIOperation)
+		}
+		paths[path][strings.ToLower(e.method)] = g.operation(e, params)
+	}
+
+	doc := envelope{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "Greenlight API",
+			"version": version,
+			"description": "Responses are JSON by default. Use the Accept header to request application/xml, or text/csv and application/x-ndjson for lists. " +
+				"Add pretty=true to the query string for indented JSON.",
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas":   g.components,
+			"responses": responses,
+			"securitySchemes": map[string]any{
+				"bearerAuth": map[string]string{
+					"type":        "http",
+					"scheme":      "bearer",
+					"description": "Authentication token returned by POST /v1/tokens/authentication",
+				},
+			},
+		},
+	}
+
+	// 文档在每次请求时才会被序列化，这里先序列化一次，让无法编码的文档在启动时就暴露出来。
+	_, err := json.Marshal(doc)
+	if err != nil {
+		panic(fmt.Sprintf("openapi: %v", err))
+	}
+	return doc
+}
+
+// openAPIPath() 把 httprouter 的路径（/v1/movies/:id、/v1/uploads/*filepath）转换为 OpenAPI 的路径模板，并返回其中的路径参数。
+// 名为 slug 和 filepath 的参数是字符串，其他的都是正整数 ID。
+func openAPIPath(path string) (string, []*openAPIParameter) {
+	segments := strings.Split(path, "/")
+	var params []*openAPIParameter
+
+	for i, segment := range segments {
+		if !strings.HasPrefix(segment, ":") && !strings.HasPrefix(segment, "*") {
+			continue
+		}
+
+		name := segment[1:]
+		segments[i] = "{" + name + "}"
+
+		schema := &jsonSchema{Type: "integer", Format: "int64", Minimum: intPtr(1)}
+		if name == "slug" || name == "filepath" {
+			schema = &jsonSchema{Type: "string"}
+		}
+		params = append(params, &openAPIParameter{Name: name, In: "path", Required: true, Schema: schema})
+	}
+
+	return strings.Join(segments, "/"), params
+}
+
+// operation() 生成端点的 Operation Object。除了 operation 中声明的内容，还会根据访问要求、路径参数和请求内容补充可能的错误响应。
+func (g *schemaGenerator) operation(e endpoint, pathParams []*openAPIParameter) *openAPIOperation {
+	op := e.operation
+
+	// 标签是路径中 /v1/ 之后的第一段，例如 movies、genres。
+	tag := strings.TrimSuffix(strings.Split(strings.TrimPrefix(e.path, "/v1/"), "/")[0], ".json")
+
+	o := &openAPIOperation{
+		OperationID: op.ID,
+		Summary:     op.Summary,
+		Tags:        []string{tag},
+		Parameters:  append(pathParams, op.Query...),
+		Responses:   make(map[string]*openAPIResponse),
+	}
+
+	// 所有请求都会经过 authenticate() 中间件，提供了无效的令牌时总是返回 401。
+	statuses := []int{http.StatusUnauthorized, http.StatusTooManyRequests, http.StatusInternalServerError}
+
+	switch e.access {
+	case accessPublic:
+	case accessActivated:
+		o.Description = "Requires an activated user account."
+		o.Security = []map[string][]string{{"bearerAuth": {}}}
+		statuses = append(statuses, http.StatusForbidden)
+	default:
+		o.Description = fmt.Sprintf("Requires the %s permission.", e.access)
+		o.Security = []map[string][]string{{"bearerAuth": {}}}
+		o.Permission = e.access
+		statuses = append(statuses, http.StatusForbidden)
+	}
+
+	if len(pathParams) > 0 {
+		statuses = append(statuses, http.StatusNotFound)
+	}
+	if op.Body != nil || op.Consumes != nil || op.Query != nil {
+		statuses = append(statuses, http.StatusBadRequest, http.StatusUnprocessableEntity)
+	}
+	statuses = append(statuses, op.Extra...)
+
+	if op.Body != nil || op.Consumes != nil {
+		o.RequestBody = &openAPIRequestBody{Required: true, Content: make(map[string]openAPIMediaType)}
+		if op.Body != nil {
+			o.RequestBody.Content["application/json"] = openAPIMediaType{Schema: g.requestSchema(op.Body)}
+		}
+		for mediaType, schema := range op.Consumes {
+			o.RequestBody.Content[mediaType] = openAPIMediaType{Schema: schema}
+		}
+	}
+
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	success := &openAPIResponse{Description: http.StatusText(status), Content: make(map[string]openAPIMediaType)}
+	if op.Response != nil {
+		success.Content["application/json"] = openAPIMediaType{Schema: g.schemaOf(reflect.TypeOf(op.Response))}
+	}
+	for _, mediaType := range op.Produces {
+		success.Content[mediaType] = openAPIMediaType{Schema: &jsonSchema{Type: "string", Format: "binary"}}
+	}
+	o.Responses[strconv.Itoa(status)] = success
+
+	for _, status := range statuses {
+		if name, ok := errorResponses[status]; ok {
+			o.Responses[strconv.Itoa(status)] = &openAPIResponse{Ref: "#/components/responses/" + name}
+		} else {
+			o.Responses[strconv.Itoa(status)] = &openAPIResponse{Description: http.StatusText(status)}
+		}
+	}
+
+	return o
+}
+
+// schemaGenerator 通过反射把 Go 类型转换为 JSON Schema，规则与 encoding/json 相同：使用 json 标签中的字段名，
+// 忽略 json:"-" 字段，展开嵌入的结构体。没有 omitempty 的字段总会出现在响应中，因此是 required。
+// 具名的结构体类型（例如 data.Movie）保存在 components 中，通过 $ref 引用。
+type schemaGenerator struct {
+	components map[string]*jsonSchema
+}
+
+func newSchemaGenerator() *schemaGenerator {
+	return &schemaGenerator{components: make(map[string]*jsonSchema)}
+}
+
+// schemaOverrides 是实现了自定义 JSON 编码的类型，它们的 schema 无法通过反射得到。
+var schemaOverrides = map[reflect.Type]jsonSchema{
+	reflect.TypeOf(time.Time{}):       {Type: "string", Format: "date-time"},
+	reflect.TypeOf(json.RawMessage{}): {},
+	reflect.TypeOf(data.RunTime(0)): {
+		Description: "Run time such as 102, \"102 mins\", \"1h 42m\" or \"PT1H42M\"; the response format depends on run_time_format",
+		OneOf:       []*jsonSchema{{Type: "string"}, {Type: "integer", Format: "int32"}},
+	},
+}
+
+// requestSchema() 生成请求体的 schema。与响应不同，请求体中的字段都是可选的（缺少的字段由处理程序报告），
+// 并且与 readJSON() 一样不允许出现未知的字段。
+func (g *schemaGenerator) requestSchema(body any) *jsonSchema {
+	schema := g.structSchema(reflect.TypeOf(body))
+	schema.Required = nil
+	schema.AdditionalProperties = false
+	return schema
+}
+
+func (g *schemaGenerator) schemaOf(t reflect.Type) *jsonSchema {
+	if override, ok := schemaOverrides[t]; ok {
+		return &override
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		schema := g.schemaOf(t.Elem())
+		if schema.Ref == "" {
+			schema.Nullable = true
+		}
+		return schema
+	case reflect.Bool:
+		return &jsonSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Uint, reflect.Uint8, reflect.Uint16:
+		return &jsonSchema{Type: "integer"}
+	case reflect.Int32, reflect.Uint32:
+		return &jsonSchema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &jsonSchema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &jsonSchema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &jsonSchema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &jsonSchema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &jsonSchema{Type: "string", Format: "byte"}
+		}
+		return &jsonSchema{Type: "array", Items: g.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &jsonSchema{Type: "object", AdditionalProperties: g.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+
+		// 先放入一个占位的 schema，这样互相引用的类型（例如 Credit 和 Person）不会无限递归。
+		name := componentName(t)
+		if _, ok := g.components[name]; !ok {
+			g.components[name] = &jsonSchema{}
+			*g.components[name] = *g.structSchema(t)
+		}
+		return &jsonSchema{Ref: "#/components/schemas/" + name}
+	default:
+		return &jsonSchema{}
+	}
+}
+
+func (g *schemaGenerator) structSchema(t reflect.Type) *jsonSchema {
+	schema := &jsonSchema{Type: "object", Properties: make(map[string]*jsonSchema)}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		// 与 encoding/json 一样，没有指定字段名的嵌入结构体，它的字段会被提升到外层对象中。
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				embedded := g.structSchema(ft)
+				for key, value := range embedded.Properties {
+					schema.Properties[key] = value
+				}
+				schema.Required = append(schema.Required, embedded.Required...)
+				continue
+			}
+		}
+
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		schema.Properties[name] = g.schemaOf(f.Type)
+		if !slices.Contains(strings.Split(opts, ","), "omitempty") {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+
+	slices.Sort(schema.Required)
+	return schema
+}
+
+// componentName() 返回具名类型在 components 中的名称，未导出的类型（例如 importReport）首字母会转换为大写。
+func componentName(t reflect.Type) string {
+	name := []rune(t.Name())
+	name[0] = unicode.ToUpper(name[0])
+	return string(name)
+}
+
+// 以下函数用于在 apiOperations 中简洁地声明查询参数。
+
+func queryParam(name, description string, schema *jsonSchema) *openAPIParameter {
+	return &openAPIParameter{Name: name, In: "query", Description: description, Schema: schema}
+}
+
+// csvParam() 声明以逗号分隔的列表参数，例如 genres=drama,crime，它们通过 readCSV() 读取。
+func csvParam(name, description string, items *jsonSchema) *openAPIParameter {
+	explode := false
+	return &openAPIParameter{Name: name, In: "query", Description: description, Style: "form", Explode: &explode, Schema: &jsonSchema{Type: "array", Items: items}}
+}
+
+func stringSchema() *jsonSchema {
+	return &jsonSchema{Type: "string"}
+}
+
+func enumSchema(values []string) *jsonSchema {
+	return &jsonSchema{Type: "string", Enum: values}
+}
+
+func integerSchema(min, max int) *jsonSchema {
+	schema := &jsonSchema{Type: "integer", Minimum: intPtr(min)}
+	if max > 0 {
+		schema.Maximum = intPtr(max)
+	}
+	return schema
+}
+
+func booleanSchema() *jsonSchema {
+	return &jsonSchema{Type: "boolean"}
+}
+
+// timeSchema() 对应 readTime()，接受 RFC 3339 时间或者 YYYY-MM-DD 格式的日期。
+func timeSchema() *jsonSchema {
+	return &jsonSchema{OneOf: []*jsonSchema{{Type: "string", Format: "date-time"}, {Type: "string", Format: "date"}}}
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+// sortedKeys() 返回 map 中排好序的键，用于从 movieIncludes 等注册表生成枚举值。
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// openAPIHandler 返回 routes() 生成的 OpenAPI 文档。与其他响应一样经过 writeResponse()，默认输出紧凑的 JSON，?pretty=true 时缩进输出。
+func (app *application) openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.writeResponse(w, r, http.StatusOK, app.openapi, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
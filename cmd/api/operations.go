@@ -0,0 +1,543 @@
+package main
+
+import (
+	"greenlight.311102.xyz/internal/data"
+	"net/http"
+)
+
+// 响应中常用的 envelope。
+
+type messageResponse struct {
+	Message string `json:"message"`
+}
+
+type movieResponse struct {
+	Movie data.Movie `json:"movie"`
+}
+
+type moviesResponse struct {
+	Movies   []data.Movie  `json:"movies"`
+	Metadata data.Metadata `json:"metadata"`
+}
+
+type recommendationsResponse struct {
+	Movies   []data.Recommendation `json:"movies"`
+	Metadata data.Metadata         `json:"metadata"`
+}
+
+type genreChangeResponse struct {
+	Genre         data.Genre `json:"genre"`
+	MoviesUpdated int64      `json:"movies_updated"`
+}
+
+type personResponse struct {
+	Person data.Person `json:"person"`
+}
+
+type listResponse struct {
+	List data.List `json:"list"`
+}
+
+type reviewResponse struct {
+	Review data.Review `json:"review"`
+}
+
+type userResponse struct {
+	User data.User `json:"user"`
+}
+
+// 多个端点共用的查询参数。
+
+// pageParams() 返回页码分页的参数，sortSafeList 为空时表示该端点不接受 sort 参数。
+func pageParams(sortSafeList []string, defaultSort string) []*openAPIParameter {
+	page := integerSchema(1, 10_000_000)
+	page.Default = 1
+	pageSize := integerSchema(1, 100)
+	pageSize.Default = 20
+
+	params := []*openAPIParameter{
+		queryParam("page", "Page number", page),
+		queryParam("page_size", "Number of records per page", pageSize),
+	}
+	if sortSafeList != nil {
+		sort := enumSchema(sortSafeList)
+		sort.Default = defaultSort
+		params = append(params, queryParam("sort", "Sort field, prefix with - for descending order", sort))
+	}
+	return params
+}
+
+// concatParams() 把几组参数连接成一个新的切片。
+func concatParams(groups ...[]*openAPIParameter) []*openAPIParameter {
+	var params []*openAPIParameter
+	for _, group := range groups {
+		params = append(params, group...)
+	}
+	return params
+}
+
+// movieFilterParams 对应 readMovieFilters() 读取的过滤条件。
+var movieFilterParams = []*openAPIParameter{
+	queryParam("title", "Full-text search on the title", stringSchema()),
+	queryParam("language", "Language used for the full-text search", stringSchema()),
+	queryParam("search_mode", "How the title is matched, fuzzy also tolerates typos", enumSchema(data.SearchModes)),
+	csvParam("genres", "Movies must have all of these genres", stringSchema()),
+	csvParam("genres_any", "Movies must have at least one of these genres", stringSchema()),
+	csvParam("genres_none", "Movies must have none of these genres", stringSchema()),
+	queryParam("year_min", "Earliest release year", integerSchema(0, 0)),
+	queryParam("year_max", "Latest release year", integerSchema(0, 0)),
+	queryParam("run_time_min", "Minimum run time in minutes", integerSchema(0, 0)),
+	queryParam("run_time_max", "Maximum run time in minutes", integerSchema(0, 0)),
+	queryParam("created_after", "Only movies created after this time", timeSchema()),
+	queryParam("created_before", "Only movies created before this time", timeSchema()),
+	queryParam("director", "Director name", stringSchema()),
+	queryParam("cast", "Cast member name", stringSchema()),
+}
+
+var runTimeFormatParam = queryParam("run_time_format", "Format of run_time in the response, can also be set with a run_time_format parameter in the Accept header", enumSchema(data.RunTimeFormats))
+
+// movieShapeParams 控制影片在响应中的表示：稀疏字段集、嵌入的关联资源以及 run_time 的格式。
+var movieShapeParams = []*openAPIParameter{
+	csvParam("fields", "Only return these fields", enumSchema(movieFieldSafeList)),
+	csvParam("include", "Related resources to embed in each movie", enumSchema(sortedKeys(movieIncludes))),
+	runTimeFormatParam,
+}
+
+// apiOperations 以 "方法 路径" 为键描述 routes() 中注册的每一个端点。新增端点时必须在这里添加对应的条目，否则 routes() 会 panic。
+var apiOperations = map[string]operation{
+	"GET /v1/healthcheck": {
+		ID:      "healthcheck",
+		Summary: "Show application status",
+		Response: struct {
+			Status     string            `json:"status"`
+			SystemInfo map[string]string `json:"system_info"`
+		}{},
+	},
+	"GET /v1/metrics": {
+		ID:       "showMetrics",
+		Summary:  "Show expvar metrics",
+		Response: map[string]any{},
+	},
+	"GET /v1/openapi.json": {
+		ID:       "showOpenAPIDocument",
+		Summary:  "Show this OpenAPI document",
+		Response: map[string]any{},
+	},
+	"GET /v1/uploads/*filepath": {
+		ID:       "showUpload",
+		Summary:  "Download an uploaded file, such as a poster",
+		Produces: []string{"image/jpeg", "image/png", "image/gif"},
+	},
+
+	"GET /v1/movies": {
+		ID:      "listMovies",
+		Summary: "List movies",
+		Query: concatParams(
+			movieFilterParams,
+			pageParams(movieSortSafeList, "id"),
+			[]*openAPIParameter{
+				csvParam("ids", "Fetch these movies by ID instead; filters, sorting and pagination are ignored and the response matches POST /v1/movies/batch-get", integerSchema(1, 0)),
+				queryParam("cursor", "Keyset pagination cursor from next_cursor or prev_cursor in the metadata", stringSchema()),
+				csvParam("facets", "Facets to count across all matching movies", enumSchema(data.FacetSafeList)),
+				queryParam("links", "Embed a _links object in the response", booleanSchema()),
+			},
+			movieShapeParams,
+		),
+		Response: struct {
+			Movies   []data.Movie                 `json:"movies"`
+			Metadata data.Metadata                `json:"metadata"`
+			Facets   data.Facets                  `json:"facets,omitempty"`
+			Links    map[string]map[string]string `json:"_links,omitempty"`
+		}{},
+		Extra: []int{http.StatusNotModified},
+	},
+	"POST /v1/movies": {
+		ID:      "createMovie",
+		Summary: "Create a movie",
+		Query: []*openAPIParameter{
+			queryParam("allow_duplicate", "Create the movie even if it may be a duplicate", booleanSchema()),
+			runTimeFormatParam,
+		},
+		Body:     createMovieInput{},
+		Status:   http.StatusCreated,
+		Response: movieResponse{},
+		Extra:    []int{http.StatusConflict},
+	},
+	"POST /v1/movies/import": {
+		ID:      "importMovies",
+		Summary: "Import movies from NDJSON or CSV",
+		Consumes: map[string]*jsonSchema{
+			"application/x-ndjson": stringSchema(),
+			"text/csv":             stringSchema(),
+		},
+		Response: struct {
+			Import importReport `json:"import"`
+		}{},
+		Extra: []int{http.StatusUnsupportedMediaType},
+	},
+	"POST /v1/movies/batch-get": {
+		ID:      "batchGetMovies",
+		Summary: "Get several movies by ID",
+		Query:   movieShapeParams,
+		Body:    batchGetMoviesInput{},
+		Response: struct {
+			Movies   []data.Movie `json:"movies"`
+			NotFound []int64      `json:"not_found"`
+		}{},
+	},
+	"GET /v1/movies/export": {
+		ID:      "exportMovies",
+		Summary: "Export all matching movies",
+		Query: concatParams(
+			movieFilterParams,
+			[]*openAPIParameter{
+				queryParam("format", "Export format, chosen from the Accept header when omitted", enumSchema(sortedKeys(exportFormats))),
+				queryParam("sort", "Sort field, prefix with - for descending order", enumSchema(movieSortSafeList)),
+				runTimeFormatParam,
+			},
+		),
+		Response: []data.Movie{},
+		Produces: []string{"application/x-ndjson", "text/csv"},
+	},
+	"GET /v1/movies/trash": {
+		ID:      "listTrash",
+		Summary: "List movies in the trash",
+		Query: concatParams(
+			pageParams(trashSortSafeList, "-deleted_at"),
+			[]*openAPIParameter{
+				csvParam("fields", "Only return these fields", enumSchema(trashFieldSafeList)),
+				runTimeFormatParam,
+			},
+		),
+		Response: moviesResponse{},
+	},
+	"GET /v1/movies/:id": {
+		ID:       "showMovie",
+		Summary:  "Show a movie",
+		Query:    movieShapeParams,
+		Response: movieResponse{},
+		Extra:    []int{http.StatusMovedPermanently, http.StatusNotModified},
+	},
+	"PATCH /v1/movies/:id": {
+		ID:      "updateMovie",
+		Summary: "Update a movie",
+		Query:   []*openAPIParameter{runTimeFormatParam},
+		Body:    updateMovieInput{},
+		Consumes: map[string]*jsonSchema{
+			mergePatchMediaType: {Type: "object", Description: "RFC 7386 JSON Merge Patch"},
+			jsonPatchMediaType:  {Type: "array", Description: "RFC 6902 JSON Patch", Items: &jsonSchema{Type: "object"}},
+		},
+		Response: movieResponse{},
+		Extra:    []int{http.StatusConflict, http.StatusPreconditionFailed},
+	},
+	"DELETE /v1/movies/:id": {
+		ID:       "deleteMovie",
+		Summary:  "Move a movie to the trash",
+		Response: messageResponse{},
+		Extra:    []int{http.StatusConflict, http.StatusPreconditionFailed},
+	},
+	"POST /v1/movies/:id/restore": {
+		ID:       "restoreMovie",
+		Summary:  "Restore a movie from the trash",
+		Query:    []*openAPIParameter{runTimeFormatParam},
+		Response: movieResponse{},
+	},
+	"POST /v1/movies/:id/merge": {
+		ID:       "mergeMovie",
+		Summary:  "Merge a duplicate movie into another movie",
+		Query:    []*openAPIParameter{runTimeFormatParam},
+		Body:     mergeMovieInput{},
+		Response: movieResponse{},
+	},
+	"GET /v1/movies/:id/revisions": {
+		ID:      "listMovieRevisions",
+		Summary: "List the revisions of a movie",
+		Query:   pageParams(revisionSortSafeList, "-version"),
+		Response: struct {
+			Revisions []data.MovieRevision `json:"revisions"`
+			Metadata  data.Metadata        `json:"metadata"`
+		}{},
+	},
+	"GET /v1/movies/:id/revisions/:version": {
+		ID:      "showMovieRevision",
+		Summary: "Show a revision of a movie and its differences from the current version",
+		Response: struct {
+			Revision       data.MovieRevision        `json:"revision"`
+			CurrentVersion int32                     `json:"current_version"`
+			Diff           map[string]data.FieldDiff `json:"diff"`
+		}{},
+	},
+	"POST /v1/movies/:id/revisions/:version/restore": {
+		ID:       "restoreMovieRevision",
+		Summary:  "Restore a movie to a previous revision",
+		Query:    []*openAPIParameter{runTimeFormatParam},
+		Response: movieResponse{},
+		Extra:    []int{http.StatusConflict, http.StatusPreconditionFailed},
+	},
+	"PUT /v1/movies/:id/rating": {
+		ID:      "rateMovie",
+		Summary: "Rate a movie",
+		Body:    rateMovieInput{},
+		Response: struct {
+			Rating  data.Rating        `json:"rating"`
+			Summary data.RatingSummary `json:"summary"`
+		}{},
+	},
+	"DELETE /v1/movies/:id/rating": {
+		ID:       "deleteRating",
+		Summary:  "Delete your rating of a movie",
+		Response: messageResponse{},
+	},
+	"GET /v1/movies/:id/reviews": {
+		ID:      "listReviews",
+		Summary: "List the reviews of a movie",
+		Query:   pageParams(reviewSortSafeList, "-created_at"),
+		Response: struct {
+			Reviews  []data.Review `json:"reviews"`
+			Metadata data.Metadata `json:"metadata"`
+		}{},
+	},
+	"POST /v1/movies/:id/reviews": {
+		ID:       "createReview",
+		Summary:  "Review a movie",
+		Body:     createReviewInput{},
+		Status:   http.StatusCreated,
+		Response: reviewResponse{},
+	},
+	"PATCH /v1/movies/:id/reviews/:review_id": {
+		ID:       "updateReview",
+		Summary:  "Update your review",
+		Body:     updateReviewInput{},
+		Response: reviewResponse{},
+		Extra:    []int{http.StatusConflict},
+	},
+	"DELETE /v1/movies/:id/reviews/:review_id": {
+		ID:       "deleteReview",
+		Summary:  "Delete a review; authors need reviews:write, other users need reviews:moderate",
+		Response: messageResponse{},
+	},
+	"PUT /v1/movies/:id/poster": {
+		ID:      "uploadPoster",
+		Summary: "Upload a movie poster",
+		Query:   []*openAPIParameter{runTimeFormatParam},
+		Consumes: map[string]*jsonSchema{
+			"multipart/form-data": {Type: "object", Properties: map[string]*jsonSchema{"poster": {Type: "string", Format: "binary"}}, Required: []string{"poster"}},
+			"image/jpeg":          {Type: "string", Format: "binary"},
+			"image/png":           {Type: "string", Format: "binary"},
+			"image/gif":           {Type: "string", Format: "binary"},
+		},
+		Response: movieResponse{},
+		Extra:    []int{http.StatusConflict, http.StatusPreconditionFailed, http.StatusUnsupportedMediaType},
+	},
+	"GET /v1/movies/:id/credits": {
+		ID:      "listMovieCredits",
+		Summary: "List the cast and crew of a movie",
+		Response: struct {
+			Credits []data.Credit `json:"credits"`
+		}{},
+	},
+	"POST /v1/movies/:id/credits": {
+		ID:      "createMovieCredit",
+		Summary: "Add a person to the cast or crew of a movie",
+		Body:    createMovieCreditInput{},
+		Status:  http.StatusCreated,
+		Response: struct {
+			Credit data.Credit `json:"credit"`
+		}{},
+	},
+	"DELETE /v1/movies/:id/credits/:credit_id": {
+		ID:       "deleteMovieCredit",
+		Summary:  "Remove a person from the cast or crew of a movie",
+		Response: messageResponse{},
+	},
+	"GET /v1/movies/:id/similar": {
+		ID:       "listSimilarMovies",
+		Summary:  "List movies similar to a movie",
+		Query:    pageParams(nil, ""),
+		Response: recommendationsResponse{},
+	},
+
+	"GET /v1/stats/movies": {
+		ID:      "showMovieStats",
+		Summary: "Show statistics for the matching movies",
+		Query:   movieFilterParams,
+		Response: struct {
+			Stats data.MovieStats `json:"stats"`
+		}{},
+	},
+
+	"GET /v1/genres": {
+		ID:      "listGenres",
+		Summary: "List genres",
+		Response: struct {
+			Genres []data.Genre `json:"genres"`
+		}{},
+	},
+	"POST /v1/genres": {
+		ID:      "createGenre",
+		Summary: "Create a genre",
+		Body:    createGenreInput{},
+		Status:  http.StatusCreated,
+		Response: struct {
+			Genre data.Genre `json:"genre"`
+		}{},
+	},
+	"GET /v1/genres/:slug": {
+		ID:      "showGenre",
+		Summary: "Get a genre",
+		Response: struct {
+			Genre data.Genre `json:"genre"`
+		}{},
+	},
+	"PATCH /v1/genres/:slug": {
+		ID:       "renameGenre",
+		Summary:  "Rename a genre and update the movies that use it",
+		Body:     renameGenreInput{},
+		Response: genreChangeResponse{},
+	},
+	"POST /v1/genres/:slug/merge": {
+		ID:       "mergeGenre",
+		Summary:  "Merge a genre into another genre",
+		Body:     mergeGenreInput{},
+		Response: genreChangeResponse{},
+	},
+
+	"GET /v1/people": {
+		ID:      "listPeople",
+		Summary: "List people",
+		Query: concatParams(
+			[]*openAPIParameter{queryParam("name", "Search by name", stringSchema())},
+			pageParams(personSortSafeList, "id"),
+		),
+		Response: struct {
+			People   []data.Person `json:"people"`
+			Metadata data.Metadata `json:"metadata"`
+		}{},
+	},
+	"POST /v1/people": {
+		ID:       "createPerson",
+		Summary:  "Create a person",
+		Body:     createPersonInput{},
+		Status:   http.StatusCreated,
+		Response: personResponse{},
+	},
+	"GET /v1/people/:id": {
+		ID:       "showPerson",
+		Summary:  "Show a person",
+		Response: personResponse{},
+	},
+	"PATCH /v1/people/:id": {
+		ID:       "updatePerson",
+		Summary:  "Update a person",
+		Body:     updatePersonInput{},
+		Response: personResponse{},
+		Extra:    []int{http.StatusConflict},
+	},
+	"DELETE /v1/people/:id": {
+		ID:       "deletePerson",
+		Summary:  "Delete a person",
+		Response: messageResponse{},
+	},
+	"GET /v1/people/:id/filmography": {
+		ID:      "listFilmography",
+		Summary: "List the movies a person worked on",
+		Query:   pageParams(filmographySortSafeList, "-year"),
+		Response: struct {
+			Person   data.Person   `json:"person"`
+			Credits  []data.Credit `json:"credits"`
+			Metadata data.Metadata `json:"metadata"`
+		}{},
+	},
+
+	"POST /v1/users": {
+		ID:       "registerUser",
+		Summary:  "Register a user and send an activation email",
+		Body:     registerUserInput{},
+		Status:   http.StatusAccepted,
+		Response: userResponse{},
+	},
+	"PUT /v1/users/activated": {
+		ID:       "activateUser",
+		Summary:  "Activate a user with the token from the activation email",
+		Body:     activateUserInput{},
+		Response: userResponse{},
+		Extra:    []int{http.StatusConflict},
+	},
+	"GET /v1/users/me/lists": {
+		ID:      "listUserLists",
+		Summary: "List your movie lists",
+		Query:   pageParams(listSortSafeList, "id"),
+		Response: struct {
+			Lists    []data.List   `json:"lists"`
+			Metadata data.Metadata `json:"metadata"`
+		}{},
+	},
+	"POST /v1/users/me/lists": {
+		ID:       "createList",
+		Summary:  "Create a movie list",
+		Body:     createListInput{},
+		Status:   http.StatusCreated,
+		Response: listResponse{},
+	},
+	"GET /v1/users/me/lists/:id": {
+		ID:       "showUserList",
+		Summary:  "Show one of your movie lists",
+		Response: listResponse{},
+	},
+	"PATCH /v1/users/me/lists/:id": {
+		ID:       "updateList",
+		Summary:  "Update one of your movie lists",
+		Body:     updateListInput{},
+		Response: listResponse{},
+		Extra:    []int{http.StatusConflict},
+	},
+	"DELETE /v1/users/me/lists/:id": {
+		ID:       "deleteList",
+		Summary:  "Delete one of your movie lists",
+		Response: messageResponse{},
+	},
+	"PUT /v1/users/me/lists/:id/items": {
+		ID:       "reorderList",
+		Summary:  "Reorder the movies in one of your lists",
+		Body:     reorderListInput{},
+		Response: listResponse{},
+	},
+	"PUT /v1/users/me/lists/:id/items/:movie_id": {
+		ID:       "addListItem",
+		Summary:  "Add a movie to one of your lists",
+		Response: listResponse{},
+	},
+	"DELETE /v1/users/me/lists/:id/items/:movie_id": {
+		ID:       "removeListItem",
+		Summary:  "Remove a movie from one of your lists",
+		Response: listResponse{},
+	},
+	"GET /v1/users/me/recommendations": {
+		ID:       "listRecommendations",
+		Summary:  "List movies recommended for you",
+		Query:    pageParams(nil, ""),
+		Response: recommendationsResponse{},
+	},
+	"GET /v1/lists/:id": {
+		ID:       "showList",
+		Summary:  "Show a public movie list",
+		Response: listResponse{},
+	},
+
+	"POST /v1/tokens/authentication": {
+		ID:      "createAuthenticationToken",
+		Summary: "Create an authentication token",
+		Body:    createAuthenticationTokenInput{},
+		Status:  http.StatusCreated,
+		Response: struct {
+			AuthenticationToken data.Token `json:"authentication_token"`
+		}{},
+	},
+
+	"POST /v1/graphql": {
+		ID:       "graphql",
+		Summary:  "Run a GraphQL query over movies, the current user and their permissions",
+		Body:     graphqlRequest{},
+		Response: graphqlResponse{},
+	},
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"greenlight.311102.xyz/internal/data"
+	"greenlight.311102.xyz/internal/jsonpatch"
+	"mime"
+	"net/http"
+)
+
+const (
+	mergePatchMediaType = "application/merge-patch+json"
+	jsonPatchMediaType  = "application/json-patch+json"
+)
+
+// movieDocument 是影片中可以被客户端修改的部分。JSON Merge Patch 和 JSON Patch 都是针对这个文档进行操作的，
+// 注意这里没有使用 omitempty，这样每个字段都一定存在，replace 和 test 操作才能正常工作。
+type movieDocument struct {
+	Title   string       `json:"title"`
+	Year    int32        `json:"year"`
+	RunTime data.RunTime `json:"run_time"`
+	Genres  []string     `json:"genres"`
+}
+
+// readMovieChanges() 根据请求的 Content-Type 读取修改内容并应用到 movie 上：
+//   - application/merge-patch+json：RFC 7386 JSON Merge Patch
+//   - application/json-patch+json：RFC 6902 JSON Patch
+//   - 其他情况：与之前一样，只修改请求中提供的字段
+func (app *application) readMovieChanges(w http.ResponseWriter, r *http.Request, movie *data.Movie) error {
+	// 无法解析的 Content-Type 按照普通的 JSON 处理，这与之前不检查 Content-Type 的行为保持一致。
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	switch mediaType {
+	case mergePatchMediaType, jsonPatchMediaType:
+		return app.readMoviePatch(w, r, mediaType, movie)
+	default:
+		return app.readMovieUpdate(w, r, movie)
+	}
+}
+
+// updateMovieInput 是 PATCH /v1/movies/:id 的请求体。
+type updateMovieInput struct {
+	Title   *string       `json:"title"`
+	Year    *int32        `json:"year"`
+	RunTime *data.RunTime `json:"run_time"`
+	Genres  []string      `json:"genres"`
+}
+
+func (app *application) readMovieUpdate(w http.ResponseWriter, r *http.Request, movie *data.Movie) error {
+	// 为了实现 按需修改 而不是 次次 都完全替换 即 将 put 替换成 patch
+	// 因为普通值传递类型 当json解析时候 字段不存在传值时直接将其赋值未该值类型的 0 值  无法区分 缺少字段直接报错 还是未传值 对字段不进行修改
+	// 所以将值传递类型 改为存储指针 对 genres 切片 类型则无需处理 若修改提交上来的 json 数据中缺少某个 字段 则为 nil
+	var input updateMovieInput
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		return err
+	}
+
+	if input.Title != nil {
+		movie.Title = *input.Title
+	}
+
+	if input.Year != nil {
+		movie.Year = *input.Year
+	}
+
+	if input.RunTime != nil {
+		movie.RunTime = *input.RunTime
+	}
+
+	if input.Genres != nil {
+		movie.Genres = input.Genres
+	}
+
+	return nil
+}
+
+// readMoviePatch() 把影片转换为 movieDocument，应用客户端提交的补丁，再把结果解码回影片。
+// 与 readJSON() 一样，补丁后的文档中不允许出现未知的字段。
+func (app *application) readMoviePatch(w http.ResponseWriter, r *http.Request, mediaType string, movie *data.Movie) error {
+	var patch json.RawMessage
+
+	err := app.readJSON(w, r, &patch)
+	if err != nil {
+		return err
+	}
+
+	doc, err := json.Marshal(movieDocument{
+		Title:   movie.Title,
+		Year:    movie.Year,
+		RunTime: movie.RunTime,
+		Genres:  movie.Genres,
+	})
+	if err != nil {
+		return err
+	}
+
+	if mediaType == mergePatchMediaType {
+		doc, err = jsonpatch.Merge(doc, patch)
+	} else {
+		doc, err = jsonpatch.Apply(doc, patch)
+	}
+	if err != nil {
+		return err
+	}
+
+	var result movieDocument
+
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.DisallowUnknownFields()
+
+	err = dec.Decode(&result)
+	if err != nil {
+		return fmt.Errorf("patched movie is invalid: %w", err)
+	}
+
+	movie.Title = result.Title
+	movie.Year = result.Year
+	movie.RunTime = result.RunTime
+	movie.Genres = result.Genres
+
+	return nil
+}
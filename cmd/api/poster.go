@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"greenlight.311102.xyz/internal/data"
+	"greenlight.311102.xyz/internal/validator"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	// 注册 GIF 和 PNG 解码器，image.Decode() 会根据文件头自动选择。JPEG 解码器已经通过 image/jpeg 注册。
+	_ "image/gif"
+	_ "image/png"
+)
+
+const (
+	maxPosterBytes     = 10 << 20
+	minPosterDimension = 100
+	maxPosterDimension = 6000
+)
+
+// posterContentTypes 是允许上传的海报格式，值为对应的原图扩展名。
+var posterContentTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// posterThumbnails 是生成的缩略图名称及其宽度，高度按原图比例计算。宽度不小于原图的尺寸会被跳过。
+var posterThumbnails = []struct {
+	name  string
+	width int
+}{
+	{"small", 154},
+	{"medium", 342},
+	{"large", 780},
+}
+
+// uploadPosterHandler 上传影片海报。请求体可以是 multipart/form-data（文件放在 poster 字段中），也可以直接是图片内容。
+// 原图和缩略图都保存到 app.storage 中，它们的地址记录在影片的 poster 字段里。与修改影片一样，上传海报会增加影片的版本号。
+func (app *application) uploadPosterHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	movie, err := app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !app.checkMoviePreconditions(w, r, movie) {
+		return
+	}
+
+	content, err := app.readPoster(w, r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// 不信任客户端声明的 Content-Type，而是根据文件内容检测真正的格式。
+	contentType := http.DetectContentType(content)
+	ext, ok := posterContentTypes[contentType]
+	if !ok {
+		app.unsupportedMediaTypeResponse(w, r)
+		return
+	}
+
+	// 先只解析图片头部获取尺寸，避免为尺寸过大的图片分配内存。
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		app.badRequestResponse(w, r, fmt.Errorf("invalid image: %w", err))
+		return
+	}
+
+	v := validator.New()
+	runTimeFormat := app.readRunTimeFormat(r, v)
+	v.Check(cfg.Width >= minPosterDimension && cfg.Height >= minPosterDimension, "poster", fmt.Sprintf("must be at least %dx%d pixels", minPosterDimension, minPosterDimension))
+	v.Check(cfg.Width <= maxPosterDimension && cfg.Height <= maxPosterDimension, "poster", fmt.Sprintf("must be at most %dx%d pixels", maxPosterDimension, maxPosterDimension))
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		app.badRequestResponse(w, r, fmt.Errorf("invalid image: %w", err))
+		return
+	}
+
+	// 文件保存在以内容摘要区分的 key 下（例如 posters/1/3f2a…/original.png），新海报不会覆盖旧的文件。
+	// 这样在影片更新成功之前，数据库中的地址始终指向完整的旧文件，而且地址随内容变化，客户端和 CDN 的缓存会自动失效。
+	sum := sha256.Sum256(content)
+	prefix := fmt.Sprintf("posters/%d/%s/", movie.ID, hex.EncodeToString(sum[:8]))
+
+	poster := &data.Poster{
+		Width:      cfg.Width,
+		Height:     cfg.Height,
+		Thumbnails: make(map[string]string),
+	}
+
+	oldKeys := posterKeys(movie.ID, movie.Poster)
+	var newKeys []string
+
+	// 上传失败或影片更新失败时删除已经写入的新文件。同样的内容再次上传时新旧 key 相同，这些文件仍被旧海报引用，不能删除。
+	cleanup := func() {
+		for _, key := range newKeys {
+			if !slices.Contains(oldKeys, key) {
+				err := app.storage.Delete(key)
+				if err != nil {
+					app.logError(r, err)
+				}
+			}
+		}
+	}
+
+	key := prefix + "original" + ext
+	err = app.storage.Put(key, bytes.NewReader(content), contentType)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	newKeys = append(newKeys, key)
+	poster.URL = app.storage.URL(key)
+
+	for _, t := range posterThumbnails {
+		if t.width >= cfg.Width {
+			continue
+		}
+
+		var buf bytes.Buffer
+		err = jpeg.Encode(&buf, resizeImage(img, t.width), &jpeg.Options{Quality: 85})
+		if err != nil {
+			cleanup()
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		key := prefix + t.name + ".jpg"
+		err = app.storage.Put(key, &buf, "image/jpeg")
+		if err != nil {
+			cleanup()
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		newKeys = append(newKeys, key)
+		poster.Thumbnails[t.name] = app.storage.URL(key)
+	}
+
+	movie.Poster = poster
+
+	err = app.models.Movies.Update(movie, app.contextGetUser(r).ID)
+	if err != nil {
+		cleanup()
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.movieEditConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// 影片已经指向新海报，现在可以删除旧海报的文件了。删除失败不影响本次上传，只记录日志。
+	for _, key := range oldKeys {
+		if !slices.Contains(newKeys, key) {
+			err = app.storage.Delete(key)
+			if err != nil {
+				app.logError(r, err)
+			}
+		}
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", formatETag(movieETag(movie), runTimeFormat))
+
+	resource, err := app.shapeMovie(movie, nil, nil, runTimeFormat)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"movie": resource}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// posterKeys() 从海报的地址中还原出原图和缩略图在 app.storage 中的 key。地址的路径以 posters/<id>/ 开头的部分就是 key，
+// 这对早期保存在固定 key 下（地址带有 ?v= 参数）的海报同样适用。poster 为 nil 时返回 nil。
+func posterKeys(movieID int64, poster *data.Poster) []string {
+	if poster == nil {
+		return nil
+	}
+
+	urls := []string{poster.URL}
+	for _, thumbnail := range poster.Thumbnails {
+		urls = append(urls, thumbnail)
+	}
+
+	prefix := fmt.Sprintf("posters/%d/", movieID)
+
+	var keys []string
+	for _, rawURL := range urls {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			continue
+		}
+		if i := strings.Index(u.Path, prefix); i >= 0 {
+			keys = append(keys, u.Path[i:])
+		}
+	}
+	return keys
+}
+
+// readPoster() 读取上传的图片内容。multipart/form-data 请求读取 poster 字段中的文件，其他请求直接读取请求体。
+func (app *application) readPoster(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	// multipart 的边界和字段头也会占用一些字节，所以这里额外留出 1MB。
+	r.Body = http.MaxBytesReader(w, r.Body, maxPosterBytes+1<<20)
+
+	var body io.Reader = r.Body
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		mr, err := r.MultipartReader()
+		if err != nil {
+			return nil, err
+		}
+
+		for {
+			part, err := mr.NextPart()
+			if errors.Is(err, io.EOF) {
+				return nil, errors.New("body must contain a poster file field")
+			}
+			if err != nil {
+				return nil, err
+			}
+			if part.FormName() == "poster" {
+				body = part
+				break
+			}
+		}
+	}
+
+	content, err := io.ReadAll(io.LimitReader(body, maxPosterBytes+1))
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			return nil, fmt.Errorf("poster must not be larger than %d bytes", maxPosterBytes)
+		}
+		return nil, err
+	}
+
+	switch {
+	case len(content) == 0:
+		return nil, errors.New("poster must not be empty")
+	case len(content) > maxPosterBytes:
+		return nil, fmt.Errorf("poster must not be larger than %d bytes", maxPosterBytes)
+	}
+
+	return content, nil
+}
+
+// resizeImage() 把图片缩小到指定宽度，高度按比例计算。每个目标像素取对应源区域内所有像素的平均值（区域平均），
+// 缩小时比最近邻采样的效果好得多，而且只需要标准库。
+func resizeImage(src image.Image, width int) image.Image {
+	b := src.Bounds()
+	height := max(b.Dy()*width/b.Dx(), 1)
+
+	dst := image.NewRGBA64(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		sy0 := b.Min.Y + y*b.Dy()/height
+		sy1 := max(b.Min.Y+(y+1)*b.Dy()/height, sy0+1)
+
+		for x := 0; x < width; x++ {
+			sx0 := b.Min.X + x*b.Dx()/width
+			sx1 := max(b.Min.X+(x+1)*b.Dx()/width, sx0+1)
+
+			var sr, sg, sb, sa, n uint64
+			for sy := sy0; sy < sy1; sy++ {
+				for sx := sx0; sx < sx1; sx++ {
+					r, g, b, a := src.At(sx, sy).RGBA()
+					sr, sg, sb, sa = sr+uint64(r), sg+uint64(g), sb+uint64(b), sa+uint64(a)
+					n++
+				}
+			}
+
+			dst.SetRGBA64(x, y, color.RGBA64{R: uint16(sr / n), G: uint16(sg / n), B: uint16(sb / n), A: uint16(sa / n)})
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,546 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// renderer 把 envelope 编码为某种媒体类型的响应体。
+type renderer interface {
+	// mediaTypes 返回该渲染器可以生成的媒体类型，第一个作为响应的 Content-Type。
+	mediaTypes() []string
+	// accepts 检查该渲染器能否表示给定的 envelope，例如 CSV 只能表示列表。
+	accepts(env envelope) bool
+	render(w io.Writer, env envelope) error
+}
+
+// renderers 是所有可用的渲染器。Accept 标头中的通配符（例如 */*）按这里的顺序选择，因此 JSON 总是首选。
+var renderers = []renderer{jsonRenderer{}, xmlRenderer{}, csvRenderer{}, ndjsonRenderer{}}
+
+// writeResponse() 根据请求的 Accept 标头选择渲染器，并发送响应。没有 Accept 标头时使用 JSON。
+// 查询字符串中包含 pretty 参数（例如 ?pretty 或 ?pretty=true）时，JSON 会缩进输出，方便在终端中查看。
+// 如果没有任何渲染器能以客户端接受的媒体类型表示 envelope，则发送 406 Not Acceptable 响应；
+// 错误响应（status >= 400）此时仍然使用 JSON 发送，避免原本的错误被 406 掩盖。
+func (app *application) writeResponse(w http.ResponseWriter, r *http.Request, status int, env envelope, headers http.Header) error {
+	rend, mediaType := negotiate(r.Header.Get("Accept"), env)
+	if rend == nil {
+		if status < http.StatusBadRequest {
+			app.notAcceptableResponse(w, r)
+			return nil
+		}
+		rend, mediaType = jsonRenderer{}, "application/json"
+	}
+
+	pretty := readPretty(r)
+	if jr, ok := rend.(jsonRenderer); ok {
+		jr.pretty = pretty
+		rend = jr
+	}
+
+	var buf bytes.Buffer
+	err := rend.render(&buf, env)
+	if err != nil {
+		return err
+	}
+
+	for key, value := range headers {
+		w.Header()[key] = value
+	}
+	// 处理程序给出的 ETag 对应的是影片本身，还要加上实际使用的媒体类型才是这个响应的 ETag。
+	if etag := headers.Get("ETag"); etag != "" {
+		w.Header().Set("ETag", representationETag(etag, mediaType, pretty))
+	}
+
+	// 同一个 URL 的响应会随 Accept 标头变化，需要告诉缓存这一点。
+	addVary(w.Header(), "Accept")
+	if strings.HasPrefix(mediaType, "text/") || mediaType == "application/xml" {
+		mediaType += "; charset=utf-8"
+	}
+	w.Header().Set("Content-Type", mediaType)
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+	return nil
+}
+
+// addVary() 把 field 加入 Vary 标头。field 已经在其中时什么也不做，这样多个地方都可以放心地调用它而不会产生重复的值。
+func addVary(h http.Header, field string) {
+	for _, value := range h.Values("Vary") {
+		for _, existing := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(existing), field) {
+				return
+			}
+		}
+	}
+	h.Add("Vary", field)
+}
+
+// negotiate() 按照 Accept 标头中各媒体类型的 q 值从高到低，选择第一个能表示 env 的渲染器，并返回实际使用的媒体类型。
+// Accept 标头为空时等同于 */*。没有可用的渲染器时返回 nil。
+func negotiate(accept string, env envelope) (renderer, string) {
+	if strings.TrimSpace(accept) == "" {
+		accept = "*/*"
+	}
+
+	type mediaRange struct {
+		mediaType string
+		q         float64
+	}
+
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if s, ok := params["q"]; ok {
+			q, err = strconv.ParseFloat(s, 64)
+			if err != nil {
+				continue
+			}
+		}
+		// q=0 表示客户端明确不接受该媒体类型。
+		if q <= 0 {
+			continue
+		}
+
+		ranges = append(ranges, mediaRange{mediaType: mediaType, q: q})
+	}
+
+	slices.SortStableFunc(ranges, func(a, b mediaRange) int {
+		switch {
+		case a.q > b.q:
+			return -1
+		case a.q < b.q:
+			return 1
+		default:
+			return 0
+		}
+	})
+
+	for _, mr := range ranges {
+		for _, rend := range renderers {
+			for _, mediaType := range rend.mediaTypes() {
+				if mediaTypeMatches(mr.mediaType, mediaType) && rend.accepts(env) {
+					return rend, mediaType
+				}
+			}
+		}
+	}
+
+	return nil, ""
+}
+
+// mediaTypeMatches() 检查 Accept 标头中的媒体范围（可能包含通配符，例如 text/*）是否包含 mediaType。
+func mediaTypeMatches(mediaRange, mediaType string) bool {
+	if mediaRange == "*/*" || mediaRange == mediaType {
+		return true
+	}
+	prefix, ok := strings.CutSuffix(mediaRange, "/*")
+	return ok && strings.HasPrefix(mediaType, prefix+"/")
+}
+
+// readPretty() 检查查询字符串中是否请求了缩进的 JSON。?pretty 不带值时视为 true。
+func readPretty(r *http.Request) bool {
+	qs := r.URL.Query()
+	if !qs.Has("pretty") {
+		return false
+	}
+	if qs.Get("pretty") == "" {
+		return true
+	}
+	pretty, err := strconv.ParseBool(qs.Get("pretty"))
+	return err == nil && pretty
+}
+
+type jsonRenderer struct {
+	pretty bool
+}
+
+func (jsonRenderer) mediaTypes() []string {
+	return []string{"application/json"}
+}
+
+func (jsonRenderer) accepts(env envelope) bool {
+	return true
+}
+
+func (jr jsonRenderer) render(w io.Writer, env envelope) error {
+	var js []byte
+	var err error
+
+	// json.MarshalIndent() 在幕后先调用 json.Marshal()，再通过 json.Indent() 添加空白，比 json.Marshal() 慢一些，而且响应更大，所以只在客户端要求时使用。
+	if jr.pretty {
+		js, err = json.MarshalIndent(env, "", "\t")
+	} else {
+		js, err = json.Marshal(env)
+	}
+	if err != nil {
+		return err
+	}
+
+	// 添加换行符，以便于在终端应用程序中查看。
+	_, err = w.Write(append(js, '\n'))
+	return err
+}
+
+// xmlRenderer 把 envelope 编码为 XML。envelope 中的值先按 JSON 的规则序列化（因此字段名和格式与 JSON 响应完全相同），
+// 然后把每个 JSON 对象的键转换为元素，数组的元素转换为 <item> 元素，根元素为 <response>。
+// 不是合法 XML 名称的键（例如校验错误中的某些键）使用 <entry key="..."> 元素表示。
+type xmlRenderer struct{}
+
+func (xmlRenderer) mediaTypes() []string {
+	return []string{"application/xml", "text/xml"}
+}
+
+func (xmlRenderer) accepts(env envelope) bool {
+	return true
+}
+
+func (xmlRenderer) render(w io.Writer, env envelope) error {
+	value, err := orderedValue(env)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	err = encodeXML(enc, "response", value)
+	if err != nil {
+		return err
+	}
+	err = enc.Flush()
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+func encodeXML(enc *xml.Encoder, name string, value any) error {
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	if !isXMLName(name) {
+		start = xml.StartElement{Name: xml.Name{Local: "entry"}, Attr: []xml.Attr{{Name: xml.Name{Local: "key"}, Value: name}}}
+	}
+
+	err := enc.EncodeToken(start)
+	if err != nil {
+		return err
+	}
+
+	switch v := value.(type) {
+	case orderedObject:
+		for _, f := range v {
+			err = encodeXML(enc, f.key, f.value)
+			if err != nil {
+				return err
+			}
+		}
+	case []any:
+		for _, item := range v {
+			err = encodeXML(enc, "item", item)
+			if err != nil {
+				return err
+			}
+		}
+	case nil:
+		// null 编码为空元素。
+	default:
+		err = enc.EncodeToken(xml.CharData(scalarString(v)))
+		if err != nil {
+			return err
+		}
+	}
+
+	return enc.EncodeToken(start.End())
+}
+
+// isXMLName() 检查 name 是否可以直接用作元素名称。这里只接受 ASCII 字母、数字、下划线和连字符，并且不能以数字、连字符或 "xml" 开头。
+func isXMLName(name string) bool {
+	if name == "" || strings.HasPrefix(strings.ToLower(name), "xml") {
+		return false
+	}
+	for i, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_':
+		case (c >= '0' && c <= '9') || c == '-':
+			if i == 0 {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// csvRenderer 把列表接口的 envelope 编码为 CSV，每条记录一行。envelope 中必须恰好有一个非空的对象数组（例如 movies），
+// 分页元数据等其他键会被忽略。列是所有记录中出现过的字段，按第一次出现的顺序排列；
+// 由标量组成的数组（例如 genres）用逗号连接，嵌套的对象（例如 rating）使用紧凑的 JSON 表示。
+type csvRenderer struct{}
+
+func (csvRenderer) mediaTypes() []string {
+	return []string{"text/csv"}
+}
+
+func (csvRenderer) accepts(env envelope) bool {
+	_, err := csvRecords(env)
+	return err == nil
+}
+
+func (csvRenderer) render(w io.Writer, env envelope) error {
+	records, err := csvRecords(env)
+	if err != nil {
+		return err
+	}
+
+	// 列表为空时无法得知有哪些列，响应体为空。
+	if len(records) == 0 {
+		return nil
+	}
+
+	var columns []string
+	for _, record := range records {
+		for _, f := range record {
+			if !slices.Contains(columns, f.key) {
+				columns = append(columns, f.key)
+			}
+		}
+	}
+
+	cw := csv.NewWriter(w)
+
+	err = cw.Write(columns)
+	if err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		row := make([]string, len(columns))
+		for _, f := range record {
+			row[slices.Index(columns, f.key)], err = csvCell(f.value)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = cw.Write(row)
+		if err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// ndjsonRenderer 把列表接口的 envelope 编码为 NDJSON，每行一条记录的紧凑 JSON。与 CSV 一样只接受恰好有一个对象数组的 envelope，
+// 其他键会被忽略。
+type ndjsonRenderer struct{}
+
+func (ndjsonRenderer) mediaTypes() []string {
+	return []string{"application/x-ndjson"}
+}
+
+func (ndjsonRenderer) accepts(env envelope) bool {
+	_, err := csvRecords(env)
+	return err == nil
+}
+
+func (ndjsonRenderer) render(w io.Writer, env envelope) error {
+	records, err := csvRecords(env)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	for _, record := range records {
+		err = enc.Encode(record)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var errNotList = errors.New("envelope does not contain exactly one list of records")
+
+// csvRecords() 返回 envelope 中唯一的非空对象数组。所有对象数组都为空时返回空列表，有多个非空的对象数组或者没有对象数组时返回错误。
+func csvRecords(env envelope) ([]orderedObject, error) {
+	value, err := orderedValue(env)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []orderedObject
+	found := false
+
+	for _, f := range value.(orderedObject) {
+		items, ok := f.value.([]any)
+		if !ok {
+			continue
+		}
+
+		objects := make([]orderedObject, 0, len(items))
+		for _, item := range items {
+			if object, ok := item.(orderedObject); ok {
+				objects = append(objects, object)
+			}
+		}
+		if len(objects) != len(items) {
+			continue
+		}
+
+		if len(objects) > 0 {
+			if len(records) > 0 {
+				return nil, errNotList
+			}
+			records = objects
+		}
+		found = true
+	}
+
+	if !found {
+		return nil, errNotList
+	}
+	return records, nil
+}
+
+func csvCell(value any) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case orderedObject:
+		js, err := json.Marshal(v)
+		return string(js), err
+	case []any:
+		parts := make([]string, len(v))
+		for i, item := range v {
+			switch item.(type) {
+			case orderedObject, []any:
+				js, err := json.Marshal(v)
+				return string(js), err
+			}
+			parts[i] = scalarString(item)
+		}
+		return strings.Join(parts, ","), nil
+	default:
+		return scalarString(v), nil
+	}
+}
+
+func scalarString(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		return ""
+	}
+}
+
+// orderedField 和 orderedObject 保存 JSON 对象的键值对，并保留键在 JSON 中出现的顺序（例如 Movie 结构体字段的顺序），
+// 这样 XML 元素和 CSV 列的顺序与 JSON 响应一致。
+type orderedField struct {
+	key   string
+	value any
+}
+
+type orderedObject []orderedField
+
+func (o orderedObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, f := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(f.key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(f.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// orderedValue() 把 v 序列化为 JSON，再解码为由 orderedObject、[]any 和标量组成的值。数字解码为 json.Number，以免丢失精度。
+func orderedValue(v any) (any, error) {
+	js, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.UseNumber()
+
+	return decodeOrdered(dec)
+}
+
+func decodeOrdered(dec *json.Decoder) (any, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		return tok, nil
+	}
+
+	switch delim {
+	case '{':
+		object := orderedObject{}
+		for dec.More() {
+			keyTok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			object = append(object, orderedField{key: keyTok.(string), value: value})
+		}
+		// 读取结尾的 '}'。
+		_, err = dec.Token()
+		return object, err
+	default:
+		items := []any{}
+		for dec.More() {
+			value, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, value)
+		}
+		// 读取结尾的 ']'。
+		_, err = dec.Token()
+		return items, err
+	}
+}
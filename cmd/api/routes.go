@@ -2,7 +2,9 @@ package main
 
 import (
 	"expvar"
+	"fmt"
 	"github.com/julienschmidt/httprouter"
+	"greenlight.311102.xyz/internal/storage"
 	"net/http"
 )
 
@@ -15,21 +17,107 @@ func (app *application) routes() http.Handler {
 	// 同样，将 methodNotAllowedResponse() 转换为 http.Handler，并将其设置为 405 Method Not Allowed 响应的自定义错误处理程序。
 	router.MethodNotAllowed = http.HandlerFunc(app.methodNotAllowedResponse)
 
-	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
+	// 每个端点都通过 route() 注册，同时记录它的方法、路径和访问要求，用于生成 OpenAPI 文档。
+	// 每个端点在 apiOperations 中都必须有对应的文档，否则在这里 panic，这样文档就不会与代码脱节。
+	var endpoints []endpoint
+	route := func(method, path, access string, handler http.HandlerFunc) http.HandlerFunc {
+		op, ok := apiOperations[method+" "+path]
+		if !ok {
+			panic(fmt.Sprintf("openapi: no operation documented for %s %s", method, path))
+		}
+		endpoints = append(endpoints, endpoint{method: method, path: path, access: access, operation: op})
 
-	router.HandlerFunc(http.MethodPost, "/v1/movies", app.requirePermission("movies:write", app.createMovieHandler))
-	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.requirePermission("movies:read", app.showMovieHandler))
-	router.HandlerFunc(http.MethodPatch, "/v1/movies/:id", app.requirePermission("movies:write", app.updateMovieHandler))
-	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id", app.requirePermission("movies:write", app.deleteMovieHandler))
-	router.HandlerFunc(http.MethodGet, "/v1/movies", app.requirePermission("movies:read", app.listMoviesHandler))
+		if app.config.openapi.validate {
+			handler = app.validateRequest(op, handler)
+		}
+		return app.requireAccess(access, handler)
+	}
+	handle := func(method, path, access string, handler http.HandlerFunc) {
+		router.HandlerFunc(method, path, route(method, path, access, handler))
+	}
 
-	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
-	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
+	handle(http.MethodGet, "/v1/healthcheck", accessPublic, app.healthcheckHandler)
 
-	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationHandler)
+	handle(http.MethodPost, "/v1/movies", "movies:write", app.createMovieHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id", app.dispatchParam("id", map[string]http.HandlerFunc{
+		"import":    route(http.MethodPost, "/v1/movies/import", "movies:write", app.importMoviesHandler),
+		"batch-get": route(http.MethodPost, "/v1/movies/batch-get", "movies:read", app.batchGetMoviesHandler),
+	}, app.methodNotAllowedResponse))
+	handle(http.MethodPost, "/v1/movies/:id/restore", "movies:write", app.restoreMovieHandler)
+	handle(http.MethodPost, "/v1/movies/:id/merge", "movies:write", app.mergeMovieHandler)
+	handle(http.MethodGet, "/v1/movies/:id/revisions", "movies:read", app.listMovieRevisionsHandler)
+	handle(http.MethodGet, "/v1/movies/:id/revisions/:version", "movies:read", app.showMovieRevisionHandler)
+	handle(http.MethodPost, "/v1/movies/:id/revisions/:version/restore", "movies:write", app.restoreMovieRevisionHandler)
+	handle(http.MethodPut, "/v1/movies/:id/rating", "reviews:write", app.rateMovieHandler)
+	handle(http.MethodDelete, "/v1/movies/:id/rating", "reviews:write", app.deleteRatingHandler)
+	handle(http.MethodGet, "/v1/movies/:id/reviews", "movies:read", app.listReviewsHandler)
+	handle(http.MethodPost, "/v1/movies/:id/reviews", "reviews:write", app.createReviewHandler)
+	handle(http.MethodPatch, "/v1/movies/:id/reviews/:review_id", "reviews:write", app.updateReviewHandler)
+	// 删除影评时，作者本人和管理员需要的权限不同，因此在处理程序中检查权限。
+	handle(http.MethodDelete, "/v1/movies/:id/reviews/:review_id", accessActivated, app.deleteReviewHandler)
+	handle(http.MethodPut, "/v1/movies/:id/poster", "movies:write", app.uploadPosterHandler)
+	handle(http.MethodGet, "/v1/movies/:id/credits", "movies:read", app.listMovieCreditsHandler)
+	handle(http.MethodPost, "/v1/movies/:id/credits", "movies:write", app.createMovieCreditHandler)
+	handle(http.MethodDelete, "/v1/movies/:id/credits/:credit_id", "movies:write", app.deleteMovieCreditHandler)
+	handle(http.MethodGet, "/v1/movies/:id/similar", "movies:read", app.listSimilarMoviesHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.dispatchParam("id", map[string]http.HandlerFunc{
+		"export": route(http.MethodGet, "/v1/movies/export", "movies:read", app.exportMoviesHandler),
+		"trash":  route(http.MethodGet, "/v1/movies/trash", "movies:write", app.listTrashHandler),
+	}, route(http.MethodGet, "/v1/movies/:id", "movies:read", app.showMovieHandler)))
+	handle(http.MethodPatch, "/v1/movies/:id", "movies:write", app.updateMovieHandler)
+	handle(http.MethodDelete, "/v1/movies/:id", "movies:write", app.deleteMovieHandler)
+	handle(http.MethodGet, "/v1/movies", "movies:read", app.listMoviesHandler)
+
+	handle(http.MethodGet, "/v1/stats/movies", "movies:read", app.movieStatsHandler)
+
+	handle(http.MethodGet, "/v1/genres", "movies:read", app.listGenresHandler)
+	handle(http.MethodPost, "/v1/genres", "genres:write", app.createGenreHandler)
+	handle(http.MethodGet, "/v1/genres/:slug", "movies:read", app.showGenreHandler)
+	handle(http.MethodPatch, "/v1/genres/:slug", "genres:write", app.renameGenreHandler)
+	handle(http.MethodPost, "/v1/genres/:slug/merge", "genres:write", app.mergeGenreHandler)
+
+	handle(http.MethodGet, "/v1/people", "movies:read", app.listPeopleHandler)
+	handle(http.MethodPost, "/v1/people", "movies:write", app.createPersonHandler)
+	handle(http.MethodGet, "/v1/people/:id", "movies:read", app.showPersonHandler)
+	handle(http.MethodPatch, "/v1/people/:id", "movies:write", app.updatePersonHandler)
+	handle(http.MethodDelete, "/v1/people/:id", "movies:write", app.deletePersonHandler)
+	handle(http.MethodGet, "/v1/people/:id/filmography", "movies:read", app.listFilmographyHandler)
+
+	handle(http.MethodPost, "/v1/users", accessPublic, app.registerUserHandler)
+	handle(http.MethodPut, "/v1/users/activated", accessPublic, app.activateUserHandler)
+
+	handle(http.MethodGet, "/v1/users/me/lists", accessActivated, app.listUserListsHandler)
+	handle(http.MethodPost, "/v1/users/me/lists", accessActivated, app.createListHandler)
+	handle(http.MethodGet, "/v1/users/me/lists/:id", accessActivated, app.showUserListHandler)
+	handle(http.MethodPatch, "/v1/users/me/lists/:id", accessActivated, app.updateListHandler)
+	handle(http.MethodDelete, "/v1/users/me/lists/:id", accessActivated, app.deleteListHandler)
+	handle(http.MethodPut, "/v1/users/me/lists/:id/items", accessActivated, app.reorderListHandler)
+	handle(http.MethodPut, "/v1/users/me/lists/:id/items/:movie_id", accessActivated, app.addListItemHandler)
+	handle(http.MethodDelete, "/v1/users/me/lists/:id/items/:movie_id", accessActivated, app.removeListItemHandler)
+	handle(http.MethodGet, "/v1/users/me/recommendations", "movies:read", app.listRecommendationsHandler)
+	handle(http.MethodGet, "/v1/lists/:id", accessActivated, app.showListHandler)
+
+	handle(http.MethodPost, "/v1/tokens/authentication", accessPublic, app.createAuthenticationHandler)
+
+	// GraphQL 端点本身是公开的，每个字段的访问要求在 graphqlQuery 中定义，由执行器在解析字段之前检查。
+	handle(http.MethodPost, "/v1/graphql", accessPublic, app.graphqlHandler)
+
+	// 使用本地文件系统存储时，由 API 服务器直接提供上传的文件。
+	if local, ok := app.storage.(*storage.Local); ok {
+		// 与 router.ServeFiles() 相同，只是通过 handle() 注册，以便出现在 OpenAPI 文档中。
+		fileServer := http.FileServer(http.Dir(local.Dir()))
+		handle(http.MethodGet, "/v1/uploads/*filepath", accessPublic, func(w http.ResponseWriter, r *http.Request) {
+			r.URL.Path = httprouter.ParamsFromContext(r.Context()).ByName("filepath")
+			fileServer.ServeHTTP(w, r)
+		})
+	}
 
 	// 注册指向 expvar 处理程序的新 GET v1/metrics 端点。
-	router.Handler(http.MethodGet, "/v1/metrics", expvar.Handler())
+	handle(http.MethodGet, "/v1/metrics", accessPublic, expvar.Handler().ServeHTTP)
+
+	// OpenAPI 文档描述上面注册的所有端点（包括它自己），因此放在最后生成。
+	handle(http.MethodGet, "/v1/openapi.json", accessPublic, app.openAPIHandler)
+	app.openapi = openAPIDocument(endpoints)
 
 	// 用 panic 恢复中间件包裹路由器。
 	// 这里需要指出的是，enableCORS() 中间件是特意放在中间件链的早期位置的。
@@ -37,3 +125,44 @@ func (app *application) routes() http.Handler {
 	// 这就意味着客户端的网络浏览器会根据同源策略阻止这些请求，而不是让客户端收到 429 太多请求（Too Many Requests）的响应。
 	return app.metrics(app.recoverPanic(app.enableCORS(app.rateLimit(app.authenticate(router)))))
 }
+
+// httprouter 不允许静态路径段与同一位置上的命名参数共存（例如 /v1/movies/export 和 /v1/movies/:id 会在注册时 panic）。
+// dispatchParam() 根据命名参数的值，把请求分发给 static 中对应的处理程序，如果没有匹配的值，则交给 next 处理。
+func (app *application) dispatchParam(name string, static map[string]http.HandlerFunc, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := httprouter.ParamsFromContext(r.Context())
+		if handler, ok := static[params.ByName(name)]; ok {
+			handler(w, r)
+			return
+		}
+		next(w, r)
+	}
+}
+
+const (
+	// accessPublic 表示端点不需要身份验证。
+	accessPublic = ""
+	// accessActivated 表示端点需要已激活的用户，但不需要特定的权限。其他的访问要求都是权限代码，例如 movies:read。
+	accessActivated = "activated"
+)
+
+// endpoint 是 routes() 中注册的一个端点。path 使用 httprouter 的语法，例如 /v1/movies/:id；
+// 通过 dispatchParam() 分发的端点使用它们实际的路径，例如 /v1/movies/export。
+type endpoint struct {
+	method    string
+	path      string
+	access    string
+	operation operation
+}
+
+// requireAccess() 根据访问要求，使用 requireActivatedUser() 或 requirePermission() 包装处理程序。
+func (app *application) requireAccess(access string, next http.HandlerFunc) http.HandlerFunc {
+	switch access {
+	case accessPublic:
+		return next
+	case accessActivated:
+		return app.requireActivatedUser(next)
+	default:
+		return app.requirePermission(access, next)
+	}
+}
@@ -71,6 +71,9 @@ func (app *application) serve() error {
 			"addr": srv.Addr,
 		})
 
+		// 通知长期运行的后台程序退出，否则下面的 Wait() 永远不会返回。
+		close(app.shutdown)
+
 		// 调用 Wait() 进行阻塞，直到我们的 WaitGroup 计数器为零 -- 本质上就是阻塞，直到后台程序结束。然后，我们在 shutdownError 频道上返回 nil，表示关机顺利完成
 		app.wg.Wait()
 		shutdownError <- nil
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"greenlight.311102.xyz/internal/data"
+	"greenlight.311102.xyz/internal/validator"
+	"net/http"
+)
+
+// movieStatsHandler 返回影片的汇总统计，接受与 listMoviesHandler 相同的过滤参数。统计需要扫描所有匹配的影片，
+// 因此结果会以过滤条件为键缓存 -stats-cache-ttl 的时间，在此期间新增或修改的影片不会立即反映在统计中。
+func (app *application) movieStatsHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	movieFilters := app.readMovieFilters(qs, v)
+
+	genres, err := app.models.Genres.Lookup()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if data.ValidateMovieFilters(v, &movieFilters, genres); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// 缓存的键只由解析和规范化之后的过滤条件构成，查询字符串中的其他参数、参数顺序和类型的写法都不会产生新的缓存条目。
+	js, err := json.Marshal(movieFilters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	key := string(js)
+
+	stats, ok := app.statsCache.Get(key)
+	if !ok {
+		stats, err = app.models.Movies.Stats(movieFilters)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		app.statsCache.Set(key, stats)
+	}
+
+	headers := make(http.Header)
+	headers.Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(app.statsCache.TTL().Seconds())))
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"stats": stats}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
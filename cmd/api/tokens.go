@@ -8,11 +8,14 @@ import (
 	"time"
 )
 
+// createAuthenticationTokenInput 是 POST /v1/tokens/authentication 的请求体。
+type createAuthenticationTokenInput struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
 func (app *application) createAuthenticationHandler(w http.ResponseWriter, r *http.Request) {
-	var input struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
-	}
+	var input createAuthenticationTokenInput
 
 	err := app.readJSON(w, r, &input)
 	if err != nil {
@@ -59,7 +62,7 @@ func (app *application) createAuthenticationHandler(w http.ResponseWriter, r *ht
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": token}, nil)
+	err = app.writeResponse(w, r, http.StatusCreated, envelope{"authentication_token": token}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"greenlight.311102.xyz/internal/data"
+	"greenlight.311102.xyz/internal/validator"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// trashSortSafeList 是回收站列表接口允许使用的排序参数。
+var trashSortSafeList = []string{"id", "title", "deleted_at", "-id", "-title", "-deleted_at"}
+
+// trashFieldSafeList 是回收站列表的 ?fields= 参数允许使用的字段。回收站中的影片比普通影片多一个 deleted_at 字段。
+var trashFieldSafeList = append(slices.Clone(movieFieldSafeList), "deleted_at")
+
+func (app *application) listTrashHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	// 默认按删除时间倒序排列，最近删除的影片排在最前面。
+	input.Filters.Sort = app.readString(qs, "sort", "-deleted_at")
+	input.Filters.SortSafeList = trashSortSafeList
+	// 与影片列表一样支持稀疏字段集和 run_time 的输出格式。
+	input.Filters.Fields = app.readCSV(qs, "fields", []string{})
+	input.Filters.FieldSafeList = trashFieldSafeList
+	runTimeFormat := app.readRunTimeFormat(r, v)
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	movies, metadata, err := app.models.Movies.GetAllDeleted(input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	resources, err := app.shapeMovies(movies, input.Filters.Fields, nil, runTimeFormat)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"movies": resources, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) restoreMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+	runTimeFormat := app.readRunTimeFormat(r, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	movie, err := app.models.Movies.Restore(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	resource, err := app.shapeMovie(movie, nil, nil, runTimeFormat)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"movie": resource}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// purgeTrash() 启动一个后台程序，每隔 purgeInterval 彻底删除一次在回收站中停留超过 retention 的影片。
+// 任意一个配置为 0 时不启动清理任务，回收站中的影片将被永久保留。
+// 后台程序通过 background() 启动，服务器关闭时会停止，并且优雅关机会等待正在进行的清理完成。
+func (app *application) purgeTrash() {
+	if app.config.trash.retention <= 0 || app.config.trash.purgeInterval <= 0 {
+		return
+	}
+
+	app.background(func() {
+		ticker := time.NewTicker(app.config.trash.purgeInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-app.shutdown:
+				return
+			case <-ticker.C:
+				app.purgeTrashOnce()
+			}
+		}
+	})
+}
+
+// purgeTrashOnce() 执行一次清理。与 background() 一样恢复 panic，这样一次失败的清理不会结束整个清理任务。
+func (app *application) purgeTrashOnce() {
+	defer func() {
+		if err := recover(); err != nil {
+			app.logger.PrintError(fmt.Errorf("%s", err), nil)
+		}
+	}()
+
+	purged, err := app.models.Movies.Purge(app.config.trash.retention)
+	if err != nil {
+		app.logger.PrintError(err, nil)
+		return
+	}
+
+	// 影片已经被彻底删除，不再有任何记录引用它们的海报文件。删除失败只记录日志，不影响其他文件的清理。
+	for id, poster := range purged {
+		for _, key := range posterKeys(id, poster) {
+			err = app.storage.Delete(key)
+			if err != nil {
+				app.logger.PrintError(err, map[string]string{"key": key})
+			}
+		}
+	}
+
+	if len(purged) > 0 {
+		app.logger.PrintInfo("purged movies from trash", map[string]string{
+			"count": strconv.Itoa(len(purged)),
+		})
+	}
+}
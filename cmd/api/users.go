@@ -8,13 +8,16 @@ import (
 	"time"
 )
 
+// registerUserInput 是 POST /v1/users 的请求体。
+type registerUserInput struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
 func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Request) {
 	// 注意 var input struct{} 和 type input struct{} 区别
-	var input struct {
-		Name     string `json:"name"`
-		Email    string `json:"email"`
-		Password string `json:"password"`
-	}
+	var input registerUserInput
 
 	err := app.readJSON(w, r, &input)
 	if err != nil {
@@ -53,8 +56,8 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	// 为新用户添加 "movies:read "权限。
-	err = app.models.Permissions.AddForUser(user.ID, "movies:read")
+	// 为新用户添加 "movies:read " 和 "reviews:write" 权限。
+	err = app.models.Permissions.AddForUser(user.ID, "movies:read", "reviews:write")
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -78,7 +81,7 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		err = app.mailer.Send(user.Email, "user_welcome.tmpl", data)
 		if err != nil {
 			// 重要的是，如果发送电子邮件时出现错误，我们将使用 app.logger.PrintError() 助手来处理，而不是像以前那样使用 app.serverErrorResponse() 助手。
-			// 我们使用 app.logger.PrintError() 助手来管理后台程序中的任何错误。这是因为当我们遇到错误时，客户端很可能已经通过我们的 writeJSON() 辅助程序发送了 202 Accepted 响应。请注意，我们不想使用 app.serverErrorResponse() 辅助函数来处理后台程序中的任何错误，因为这会导致我们尝试编写第二个 HTTP 响应，并在运行时从 http.Server 收到 "http: superfluous response.WriteHeader call"（http：多余的 response.WriteHeader 调用）错误。
+			// 我们使用 app.logger.PrintError() 助手来管理后台程序中的任何错误。这是因为当我们遇到错误时，客户端很可能已经通过我们的 writeResponse() 辅助程序发送了 202 Accepted 响应。请注意，我们不想使用 app.serverErrorResponse() 辅助函数来处理后台程序中的任何错误，因为这会导致我们尝试编写第二个 HTTP 响应，并在运行时从 http.Server 收到 "http: superfluous response.WriteHeader call"（http：多余的 response.WriteHeader 调用）错误。
 			// 在后台程序中运行的代码会对用户和应用程序变量形成封闭。需要注意的是，这些 "封闭 "变量的作用域与后台程序无关，这意味着你对它们所做的任何更改都会反映在代码库的其他部分。
 			// 在我们的例子中，我们没有以任何方式更改这些变量的值，因此此行为不会给我们带来任何问题。但重要的是要记住这一点。
 			app.logger.PrintError(err, nil)
@@ -87,16 +90,19 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 	})
 
 	// 请注意，我们也会将其改为向客户端发送 202 Accepted 状态代码。此状态代码表示请求已被接受处理，但处理尚未完成
-	err = app.writeJSON(w, http.StatusAccepted, envelope{"user": user}, nil)
+	err = app.writeResponse(w, r, http.StatusAccepted, envelope{"user": user}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
+// activateUserInput 是 PUT /v1/users/activated 的请求体。
+type activateUserInput struct {
+	TokenPlaintext string `json:"token"`
+}
+
 func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Request) {
-	var input struct {
-		TokenPlaintext string `json:"token"`
-	}
+	var input activateUserInput
 
 	err := app.readJSON(w, r, &input)
 	if err != nil {
@@ -143,7 +149,7 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"user": user}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
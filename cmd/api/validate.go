@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"greenlight.311102.xyz/internal/validator"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxValidatedBodyBytes 与 readJSON() 中的限制相同。超过这个大小的请求体不做检查，交给处理程序报告错误。
+const maxValidatedBodyBytes = 1_048_576
+
+// validateRequest() 在请求到达处理程序之前，按照 OpenAPI 文档检查查询参数和 JSON 请求体，不符合时发送 422 响应。
+// 这里只检查类型、枚举值、取值范围和未知字段等与文档相关的问题，必填字段等业务规则仍然由处理程序检查。
+// 无法解析的 JSON 同样交给处理程序，由 readJSON() 给出更具体的错误信息。
+func (app *application) validateRequest(op operation, next http.HandlerFunc) http.HandlerFunc {
+	var body *jsonSchema
+	components := map[string]*jsonSchema{}
+	if op.Body != nil {
+		g := newSchemaGenerator()
+		body = g.requestSchema(op.Body)
+		components = g.components
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		v := validator.New()
+
+		qs := r.URL.Query()
+		for _, param := range op.Query {
+			value := qs.Get(param.Name)
+			if value == "" {
+				continue
+			}
+
+			if param.Schema.Type == "array" {
+				for _, item := range strings.Split(value, ",") {
+					checkParameter(v, param.Name, strings.TrimSpace(item), param.Schema.Items)
+				}
+			} else {
+				checkParameter(v, param.Name, value, param.Schema)
+			}
+		}
+
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if _, ok := op.Consumes[mediaType]; body != nil && !ok {
+			// 读取请求体之后，把读到的内容放回去，处理程序仍然可以读取完整的请求体。
+			b, err := io.ReadAll(io.LimitReader(r.Body, maxValidatedBodyBytes+1))
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(b), r.Body), r.Body}
+
+			if err == nil && len(b) <= maxValidatedBodyBytes {
+				dec := json.NewDecoder(bytes.NewReader(b))
+				dec.UseNumber()
+
+				var value any
+				if dec.Decode(&value) == nil {
+					checkValue(v, components, "", value, body)
+				}
+			}
+		}
+
+		if !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// checkParameter() 检查查询参数中的一个值是否符合 schema，错误信息与 readInt() 等辅助函数保持一致。
+func checkParameter(v *validator.Validator, name, value string, schema *jsonSchema) {
+	if schema.OneOf != nil {
+		for _, alternative := range schema.OneOf {
+			check := validator.New()
+			if checkParameter(check, name, value, alternative); check.Valid() {
+				return
+			}
+		}
+		v.AddError(name, "must be "+describeSchema(schema))
+		return
+	}
+
+	switch schema.Type {
+	case "integer":
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			v.AddError(name, "must be an integer value")
+			return
+		}
+		checkRange(v, name, i, schema)
+	case "boolean":
+		_, err := strconv.ParseBool(value)
+		v.Check(err == nil, name, "must be a boolean value")
+	case "string":
+		switch schema.Format {
+		case "date-time":
+			_, err := time.Parse(time.RFC3339, value)
+			v.Check(err == nil, name, "must be an RFC 3339 timestamp")
+		case "date":
+			_, err := time.Parse(time.DateOnly, value)
+			v.Check(err == nil, name, "must be a YYYY-MM-DD date")
+		}
+		if schema.Enum != nil {
+			v.Check(slices.Contains(schema.Enum, value), name, "must be one of "+strings.Join(schema.Enum, ", "))
+		}
+	}
+}
+
+// checkValue() 递归地检查 JSON 请求体中的值是否符合 schema。path 是值在请求体中的位置，例如 genres[1]，用作错误信息的键。
+// 与 encoding/json 一样，任何位置的 null 都是允许的。
+func checkValue(v *validator.Validator, components map[string]*jsonSchema, path string, value any, schema *jsonSchema) {
+	if schema.Ref != "" {
+		schema = components[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+	}
+	if value == nil {
+		return
+	}
+
+	key := path
+	if key == "" {
+		key = "body"
+	}
+
+	if schema.OneOf != nil {
+		for _, alternative := range schema.OneOf {
+			check := validator.New()
+			if checkValue(check, components, path, value, alternative); check.Valid() {
+				return
+			}
+		}
+		v.AddError(key, "must be "+describeSchema(schema))
+		return
+	}
+
+	switch schema.Type {
+	case "object":
+		object, ok := value.(map[string]any)
+		if !ok {
+			v.AddError(key, "must be an object")
+			return
+		}
+
+		for name, item := range object {
+			itemPath := name
+			if path != "" {
+				itemPath = path + "." + name
+			}
+
+			if property, ok := schema.Properties[name]; ok {
+				checkValue(v, components, itemPath, item, property)
+				continue
+			}
+
+			switch additional := schema.AdditionalProperties.(type) {
+			case *jsonSchema:
+				checkValue(v, components, itemPath, item, additional)
+			case bool:
+				v.Check(additional, itemPath, "unknown field")
+			}
+		}
+	case "array":
+		array, ok := value.([]any)
+		if !ok {
+			v.AddError(key, "must be an array")
+			return
+		}
+
+		for i, item := range array {
+			checkValue(v, components, fmt.Sprintf("%s[%d]", path, i), item, schema.Items)
+		}
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			v.AddError(key, "must be a string")
+			return
+		}
+		if schema.Enum != nil {
+			v.Check(slices.Contains(schema.Enum, s), key, "must be one of "+strings.Join(schema.Enum, ", "))
+		}
+	case "integer":
+		n, ok := value.(json.Number)
+		if !ok {
+			v.AddError(key, "must be an integer")
+			return
+		}
+		i, err := strconv.Atoi(n.String())
+		if err != nil {
+			v.AddError(key, "must be an integer")
+			return
+		}
+		checkRange(v, key, i, schema)
+	case "number":
+		_, ok := value.(json.Number)
+		v.Check(ok, key, "must be a number")
+	case "boolean":
+		_, ok := value.(bool)
+		v.Check(ok, key, "must be a boolean")
+	}
+}
+
+func checkRange(v *validator.Validator, key string, i int, schema *jsonSchema) {
+	if schema.Minimum != nil {
+		v.Check(i >= *schema.Minimum, key, fmt.Sprintf("must be at least %d", *schema.Minimum))
+	}
+	if schema.Maximum != nil {
+		v.Check(i <= *schema.Maximum, key, fmt.Sprintf("must be at most %d", *schema.Maximum))
+	}
+}
+
+// describeSchema() 用于 oneOf 的错误信息，例如 "a string or an integer"。
+func describeSchema(schema *jsonSchema) string {
+	var alternatives []string
+	for _, alternative := range schema.OneOf {
+		description := alternative.Type
+		if alternative.Format == "date-time" || alternative.Format == "date" {
+			description = alternative.Format
+		}
+		if strings.IndexAny(description, "aeiou") == 0 {
+			description = "an " + description
+		} else {
+			description = "a " + description
+		}
+		if !slices.Contains(alternatives, description) {
+			alternatives = append(alternatives, description)
+		}
+	}
+	return strings.Join(alternatives, " or ")
+}
@@ -0,0 +1,84 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// sweepThreshold 是触发清理过期条目的条目数量。条目数量少于它时过期的条目只是在读取时被忽略。
+const sweepThreshold = 1000
+
+type entry[V any] struct {
+	value     V
+	expiresAt time.Time
+}
+
+// TTL 是一个并发安全的内存缓存，每个值在写入 ttl 之后过期。ttl 为 0 时不缓存任何值。
+// 缓存最多保存 maxEntries 个条目，已满时写入新的条目会淘汰最早写入的条目。
+type TTL[V any] struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	entries    map[string]entry[V]
+}
+
+func New[V any](ttl time.Duration, maxEntries int) *TTL[V] {
+	return &TTL[V]{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[string]entry[V]),
+	}
+}
+
+// TTL 返回缓存值的有效期。
+func (c *TTL[V]) TTL() time.Duration {
+	return c.ttl
+}
+
+// Get 返回 key 对应的值。key 不存在或者值已经过期时第二个返回值为 false。
+func (c *TTL[V]) Get(key string) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok || time.Now().After(e.expiresAt) {
+		var zero V
+		return zero, false
+	}
+	return e.value, true
+}
+
+// Set 保存 key 对应的值。条目数量超过 sweepThreshold 时顺带删除所有过期的条目；仍然超过 maxEntries 时淘汰最早写入的条目，
+// 这样无论客户端使用多少不同的 key，缓存的大小都是有上限的。
+func (c *TTL[V]) Set(key string, value V) {
+	if c.ttl <= 0 || c.maxEntries <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+
+	if len(c.entries) >= sweepThreshold {
+		for k, e := range c.entries {
+			if now.After(e.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+	}
+
+	// 所有条目的有效期都相同，所以最早过期的条目就是最早写入的条目。
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.maxEntries {
+		var oldest string
+		var oldestExpiresAt time.Time
+		for k, e := range c.entries {
+			if oldestExpiresAt.IsZero() || e.expiresAt.Before(oldestExpiresAt) {
+				oldest, oldestExpiresAt = k, e.expiresAt
+			}
+		}
+		delete(c.entries, oldest)
+	}
+
+	c.entries[key] = entry[V]{value: value, expiresAt: now.Add(c.ttl)}
+}
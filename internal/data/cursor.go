@@ -0,0 +1,64 @@
+package data
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// cursor 是键集（keyset）分页使用的游标。它记录了生成游标时使用的排序参数、最后（或第一）一行记录的排序列值以及 id，
+// 对客户端来说它是不透明的，只需要原样传回即可。
+// Value 统一保存为字符串，查询时 PostgreSQL 会根据比较的列推断出参数的实际类型。
+type cursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    int64  `json:"i"`
+	Prev  bool   `json:"p,omitempty"` // 为 true 时表示向前翻页（上一页）
+}
+
+// encode() 将游标编码为 URL 安全的 base64 字符串。
+func (c cursor) encode() string {
+	js, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+// decodeCursor() 解析客户端传入的游标字符串，任何格式上的问题都会返回 ErrInvalidCursor 错误。
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+
+	js, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+
+	err = json.Unmarshal(js, &c)
+	if err != nil || c.Sort == "" || c.ID < 1 {
+		return c, ErrInvalidCursor
+	}
+
+	return c, nil
+}
+
+// movieCursor() 根据当前的排序参数，为给定的影片生成游标。prev 为 true 时生成的是上一页游标。
+func (f Filters) movieCursor(movie *Movie, prev bool) string {
+	var value string
+
+	switch f.sortColumn() {
+	case "id":
+		value = strconv.FormatInt(movie.ID, 10)
+	case "title":
+		value = movie.Title
+	case "year":
+		value = strconv.FormatInt(int64(movie.Year), 10)
+	case "run_time":
+		value = strconv.FormatInt(int64(movie.RunTime), 10)
+	default:
+		// relevance 这样的排序依据是查询时计算出来的，不能作为键集分页的条件，因此不生成游标。
+		return ""
+	}
+
+	return cursor{Sort: f.Sort, Value: value, ID: movie.ID, Prev: prev}.encode()
+}
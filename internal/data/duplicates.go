@@ -0,0 +1,158 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// duplicateSimilarity 是判断两个同年份影片标题是否重复的三元组相似度下限。
+const duplicateSimilarity = 0.7
+
+// FindDuplicates 返回可能与 movie 重复的影片 ID，按相似程度从高到低排列，最多 10 个。同一年份的影片中，
+// 标题在忽略大小写、空白和标点之后完全相同，或者标题的三元组相似度不低于 duplicateSimilarity 的都被视为可能重复。
+func (m MovieModel) FindDuplicates(movie *Movie) ([]int64, error) {
+	query := `
+		SELECT id
+		FROM movies
+		WHERE year = $2 AND deleted_at IS NULL
+		AND (regexp_replace(lower(title), '[^[:alnum:]]+', '', 'g') = regexp_replace(lower($1), '[^[:alnum:]]+', '', 'g')
+		     OR similarity(title, $1) >= $3)
+		ORDER BY similarity(title, $1) DESC, id ASC
+		LIMIT 10`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movie.Title, movie.Year, duplicateSimilarity)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+
+	for rows.Next() {
+		var id int64
+		err := rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// Merge 把重复的影片 duplicateID 合并到 canonicalID 中：评分、影评、列表中的条目和演职人员都移动到保留的影片上
+// （同一用户、同一列表或同一职务已经存在于保留影片上的记录会被丢弃），然后删除重复的影片，并把它的 ID 保留为指向 canonicalID 的重定向。
+// 之前指向重复影片的重定向也会改为指向 canonicalID。保留的影片的表示形式因此发生了变化，与 MovieModel.Update() 一样，
+// 它的版本号加一，并在同一个事务中记录 userID 修改的新版本。任意一部影片不存在（或在回收站中）时返回 ErrRecordNotFound。
+// 返回被删除的重复影片的海报（没有海报时为 nil），调用者应该在合并成功之后删除它的文件。
+func (m MovieModel) Merge(duplicateID, canonicalID, userID int64) (*Poster, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// 按 ID 顺序锁定两部影片，避免两个方向相反的合并互相死锁，也避免合并期间影片被修改或删除。
+	var locked int
+	err = tx.QueryRowContext(ctx, `
+		SELECT count(*) FROM (
+			SELECT id FROM movies
+			WHERE id IN ($1, $2) AND deleted_at IS NULL
+			ORDER BY id
+			FOR UPDATE
+		) AS locked`, duplicateID, canonicalID).Scan(&locked)
+	if err != nil {
+		return nil, err
+	}
+	if locked != 2 {
+		return nil, ErrRecordNotFound
+	}
+
+	statements := []string{
+		`UPDATE ratings SET movie_id = $2
+		WHERE movie_id = $1 AND user_id NOT IN (SELECT user_id FROM ratings WHERE movie_id = $2)`,
+		`UPDATE reviews SET movie_id = $2
+		WHERE movie_id = $1 AND user_id NOT IN (SELECT user_id FROM reviews WHERE movie_id = $2)`,
+		`UPDATE list_items SET movie_id = $2
+		WHERE movie_id = $1 AND list_id NOT IN (SELECT list_id FROM list_items WHERE movie_id = $2)`,
+		`UPDATE movie_credits SET movie_id = $2
+		WHERE movie_id = $1 AND NOT EXISTS (
+			SELECT 1 FROM movie_credits AS c
+			WHERE c.movie_id = $2 AND c.person_id = movie_credits.person_id
+			AND c.role = movie_credits.role AND c.character = movie_credits.character
+		)`,
+		`UPDATE movie_redirects SET target_id = $2 WHERE target_id = $1`,
+		`INSERT INTO movie_redirects (movie_id, target_id) VALUES ($1, $2)`,
+		// 补录保留影片的当前版本，然后增加版本号，保证版本历史是连续的。
+		`INSERT INTO movie_revisions (movie_id, version, title, year, run_time, genres, created_at)
+		SELECT id, version, title, year, run_time, genres, created_at
+		FROM movies
+		WHERE id = $2
+		ON CONFLICT DO NOTHING`,
+		`UPDATE movies SET version = version + 1 WHERE id = $2`,
+	}
+
+	for _, statement := range statements {
+		_, err = tx.ExecContext(ctx, statement, duplicateID, canonicalID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO movie_revisions (movie_id, version, title, year, run_time, genres, user_id)
+		SELECT id, version, title, year, run_time, genres, $2
+		FROM movies
+		WHERE id = $1`, canonicalID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 没有移动的记录和重复影片的版本历史会随影片一起被级联删除。
+	var poster *Poster
+
+	err = tx.QueryRowContext(ctx, `DELETE FROM movies WHERE id = $1 RETURNING poster`, duplicateID).Scan(&poster)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return poster, nil
+}
+
+// Redirect 返回被合并的影片 id 所指向的影片 ID。id 不是被合并的影片时返回 ErrRecordNotFound。
+func (m MovieModel) Redirect(id int64) (int64, error) {
+	if id < 1 {
+		return 0, ErrRecordNotFound
+	}
+
+	query := `SELECT target_id FROM movie_redirects WHERE movie_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var targetID int64
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&targetID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+	return targetID, nil
+}
@@ -0,0 +1,104 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"greenlight.311102.xyz/internal/validator"
+	"time"
+)
+
+// FacetSafeList 是影片列表可以请求的分面统计。
+var FacetSafeList = []string{"genres", "decade", "run_time_bucket"}
+
+// FacetCount 是某个分面中一个取值对应的影片数量。
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// Facets 以分面名称为键，保存每个分面下各个取值的数量。
+type Facets map[string][]FacetCount
+
+// facetQueries 保存每个分面对应的查询，%s 会被替换为 MovieFilters.where() 生成的 WHERE 条件，
+// 因此统计结果总是与当前的过滤条件保持一致（但不受分页和排序影响）。
+var facetQueries = map[string]string{
+	// 一部影片有多个类型时，它会在每个类型下各计数一次。
+	"genres": `
+		SELECT g.genre, count(*)
+		FROM movies, unnest(genres) AS g(genre)
+		WHERE %s
+		GROUP BY g.genre
+		ORDER BY count(*) DESC, g.genre ASC`,
+	"decade": `
+		SELECT (year / 10 * 10)::text || 's', count(*)
+		FROM movies
+		WHERE %s
+		GROUP BY year / 10
+		ORDER BY year / 10 ASC`,
+	"run_time_bucket": `
+		SELECT bucket, count(*)
+		FROM (
+			SELECT CASE
+				WHEN run_time < 90 THEN 1
+				WHEN run_time < 120 THEN 2
+				WHEN run_time < 150 THEN 3
+				ELSE 4
+			END AS n
+			FROM movies
+			WHERE %s
+		) AS b
+		JOIN (VALUES (1, '<90'), (2, '90-119'), (3, '120-149'), (4, '150+')) AS v(n, bucket) USING (n)
+		GROUP BY n, bucket
+		ORDER BY n ASC`,
+}
+
+func ValidateFacets(v *validator.Validator, facets []string) {
+	for _, facet := range facets {
+		v.Check(validator.PermittedValue(facet, FacetSafeList...), "facets", "invalid facet value: "+facet)
+	}
+	v.Check(validator.Unique(facets), "facets", "must not contain duplicate values")
+}
+
+// Facets 为给定的过滤条件计算分面统计，每个分面执行一条 GROUP BY 查询。names 中的值必须已经通过 ValidateFacets() 的检查。
+func (m MovieModel) Facets(movieFilters MovieFilters, names []string) (Facets, error) {
+	where, args := movieFilters.where()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	facets := make(Facets, len(names))
+
+	for _, name := range names {
+		query, ok := facetQueries[name]
+		if !ok {
+			panic("unsafe facet parameter: " + name)
+		}
+
+		rows, err := m.DB.QueryContext(ctx, fmt.Sprintf(query, where), args...)
+		if err != nil {
+			return nil, err
+		}
+
+		// 与 movies 一样，没有数据时返回 [] 而不是 null。
+		counts := []FacetCount{}
+
+		for rows.Next() {
+			var fc FacetCount
+			err := rows.Scan(&fc.Value, &fc.Count)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+			counts = append(counts, fc)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		facets[name] = counts
+	}
+
+	return facets, nil
+}
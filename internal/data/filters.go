@@ -3,14 +3,18 @@ package data
 import (
 	"greenlight.311102.xyz/internal/validator"
 	"math"
+	"slices"
 	"strings"
 )
 
 type Filters struct {
-	Page         int
-	PageSize     int
-	Sort         string
-	SortSafeList []string
+	Page          int
+	PageSize      int
+	Sort          string
+	SortSafeList  []string
+	Cursor        string   // 不为空时使用键集（游标）分页，此时将忽略 Page
+	Fields        []string // 客户端请求的字段（稀疏字段集），为空时返回全部字段
+	FieldSafeList []string
 }
 
 func ValidateFilters(v *validator.Validator, f Filters) {
@@ -21,6 +25,26 @@ func ValidateFilters(v *validator.Validator, f Filters) {
 
 	// 检查排序参数是否与安全列表中的值匹配。
 	v.Check(validator.PermittedValue(f.Sort, f.SortSafeList...), "sort", "invalid sort value")
+
+	ValidateFields(v, f.Fields, f.FieldSafeList)
+
+	// 游标必须能够被正确解析，并且必须是在相同的排序参数下生成的，否则键集条件将毫无意义。
+	if f.Cursor != "" {
+		c, err := decodeCursor(f.Cursor)
+		if err != nil {
+			v.AddError("cursor", "must be a valid cursor")
+			return
+		}
+		v.Check(c.Sort == f.Sort, "cursor", "does not match the sort value")
+	}
+}
+
+// ValidateFields 与排序参数一样，检查客户端请求的每个字段是否都在安全列表中。
+func ValidateFields(v *validator.Validator, fields []string, safeList []string) {
+	for _, field := range fields {
+		v.Check(validator.PermittedValue(field, safeList...), "fields", "invalid field value: "+field)
+	}
+	v.Check(validator.Unique(fields), "fields", "must not contain duplicate values")
 }
 
 // 检查客户提供的 "排序 "字段是否与安全列表中的某个条目相匹配，如果相匹配，则从 "sort" 字段中提取列名，删除前导连字符（如果存在）。
@@ -41,6 +65,28 @@ func (f Filters) sortDirection() string {
 	return "ASC"
 }
 
+// movieColumns() 返回影片列表需要查询的列。没有请求稀疏字段集时返回全部列；否则只返回请求的列，
+// 再加上 id、version 和排序列，因为生成 ETag 和游标时需要用到它们。读取单部影片时没有排序参数，也就不需要排序列。
+func (f Filters) movieColumns() []string {
+	all := []string{"id", "created_at", "title", "year", "run_time", "genres", "version", "poster"}
+	if len(f.Fields) == 0 {
+		return all
+	}
+
+	columns := make([]string, 0, len(all))
+	for _, column := range all {
+		if column == "id" || column == "version" || (f.Sort != "" && column == f.sortColumn()) || slices.Contains(f.Fields, column) {
+			columns = append(columns, column)
+		}
+	}
+	return columns
+}
+
+// wantsField() 检查响应中是否需要包含某个字段。没有请求稀疏字段集时包含全部字段。
+func (f Filters) wantsField(field string) bool {
+	return len(f.Fields) == 0 || slices.Contains(f.Fields, field)
+}
+
 func (f Filters) limit() int {
 	return f.PageSize
 }
@@ -52,11 +98,13 @@ func (f Filters) offset() int {
 
 // Metadata omitempty 空属性 省略
 type Metadata struct {
-	CurrentPage  int `json:"current_page,omitempty"`
-	PageSize     int `json:"page_size,omitempty"`
-	FirstPage    int `json:"first_page,omitempty"`
-	LastPage     int `json:"last_page,omitempty"`
-	TotalRecords int `json:"total_records,omitempty"`
+	CurrentPage  int    `json:"current_page,omitempty"`
+	PageSize     int    `json:"page_size,omitempty"`
+	FirstPage    int    `json:"first_page,omitempty"`
+	LastPage     int    `json:"last_page,omitempty"`
+	TotalRecords int    `json:"total_records,omitempty"`
+	NextCursor   string `json:"next_cursor,omitempty"`
+	PrevCursor   string `json:"prev_cursor,omitempty"`
 }
 
 // calculateMetadata() 函数根据记录总数、当前页面和页面大小值计算相应的分页元数据值。
@@ -0,0 +1,420 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+	"greenlight.311102.xyz/internal/validator"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+var ErrDuplicateGenre = errors.New("duplicate genre")
+
+var genreSlugRX = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+
+// GenreSlug 把类型名称转换为 slug，例如 "Science Fiction" 转换为 "science-fiction"。
+// 字母和数字包括所有语言的字符，例如 "Ciencia Ficción" 转换为 "ciencia-ficción"。
+func GenreSlug(name string) string {
+	return strings.Trim(genreSlugRX.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+// Genre 是类型表中的一个类型。影片的 genres 字段中保存的是 Slug，Aliases 中的写法在校验影片时会被规范化为 Slug。
+type Genre struct {
+	ID         int64     `json:"id"`
+	Slug       string    `json:"slug"`
+	Name       string    `json:"name"`
+	Aliases    []string  `json:"aliases"`
+	MovieCount int       `json:"movie_count"`
+	CreatedAt  time.Time `json:"-"`
+}
+
+func ValidateGenre(v *validator.Validator, genre *Genre) {
+	v.Check(genre.Name != "", "name", "must be provided")
+	v.Check(len(genre.Name) <= 100, "name", "must not be more than 100 bytes long")
+	v.Check(genre.Slug != "", "name", "must contain at least one letter or digit")
+	v.Check(len(genre.Aliases) <= 20, "aliases", "must not contain more than 20 values")
+	v.Check(validator.Unique(genre.Aliases), "aliases", "must not contain duplicate values")
+	for _, alias := range genre.Aliases {
+		v.Check(alias != "", "aliases", "must only contain values with at least one letter or digit")
+		v.Check(alias != genre.Slug, "aliases", "must not contain the genre's own slug")
+	}
+}
+
+// GenreLookup 把类型的 slug 和别名映射到类型的 slug，用于在 ValidateMovie() 中规范化影片的类型。
+type GenreLookup map[string]string
+
+// Normalize 把 genres 中的每个值规范化为类型表中的 slug，并去掉规范化之后重复的值。无法识别的值会在第二个返回值中返回。
+func (l GenreLookup) Normalize(genres []string) ([]string, []string) {
+	normalized := make([]string, 0, len(genres))
+	var unknown []string
+
+	for _, genre := range genres {
+		slug, ok := l[GenreSlug(genre)]
+		if !ok {
+			unknown = append(unknown, genre)
+			continue
+		}
+		if !slices.Contains(normalized, slug) {
+			normalized = append(normalized, slug)
+		}
+	}
+
+	return normalized, unknown
+}
+
+type GenreModel struct {
+	DB *sql.DB
+}
+
+// GetAll 返回所有类型以及使用每个类型的影片数量（不包括回收站中的影片）。
+func (m GenreModel) GetAll() ([]*Genre, error) {
+	query := `
+		SELECT genres.id, genres.slug, genres.name, genres.aliases, genres.created_at,
+		       (SELECT count(*) FROM movies WHERE movies.genres @> ARRAY[genres.slug] AND movies.deleted_at IS NULL)
+		FROM genres
+		ORDER BY genres.slug`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	genres := []*Genre{}
+
+	for rows.Next() {
+		var genre Genre
+		err := rows.Scan(
+			&genre.ID,
+			&genre.Slug,
+			&genre.Name,
+			pq.Array(&genre.Aliases),
+			&genre.CreatedAt,
+			&genre.MovieCount,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		genres = append(genres, &genre)
+	}
+
+	return genres, rows.Err()
+}
+
+// Get 返回 slug 对应的类型以及使用它的影片数量（不包括回收站中的影片）。
+func (m GenreModel) Get(slug string) (*Genre, error) {
+	query := `
+		SELECT genres.id, genres.slug, genres.name, genres.aliases, genres.created_at,
+		       (SELECT count(*) FROM movies WHERE movies.genres @> ARRAY[genres.slug] AND movies.deleted_at IS NULL)
+		FROM genres
+		WHERE genres.slug = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var genre Genre
+
+	err := m.DB.QueryRowContext(ctx, query, slug).Scan(
+		&genre.ID,
+		&genre.Slug,
+		&genre.Name,
+		pq.Array(&genre.Aliases),
+		&genre.CreatedAt,
+		&genre.MovieCount,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &genre, nil
+}
+
+// Lookup 返回当前类型表对应的 GenreLookup。
+func (m GenreModel) Lookup() (GenreLookup, error) {
+	query := `SELECT slug, aliases FROM genres`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lookup := make(GenreLookup)
+
+	for rows.Next() {
+		var slug string
+		var aliases []string
+
+		err := rows.Scan(&slug, pq.Array(&aliases))
+		if err != nil {
+			return nil, err
+		}
+
+		lookup[slug] = slug
+		for _, alias := range aliases {
+			lookup[alias] = slug
+		}
+	}
+
+	return lookup, rows.Err()
+}
+
+// Insert 创建一个类型。slug 或任何一个别名已经被其他类型使用时返回 ErrDuplicateGenre。
+func (m GenreModel) Insert(genre *Genre) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = checkGenreNames(ctx, tx, 0, append([]string{genre.Slug}, genre.Aliases...))
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO genres (slug, name, aliases)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at`
+
+	err = tx.QueryRowContext(ctx, query, genre.Slug, genre.Name, pqStringArray(genre.Aliases)).Scan(&genre.ID, &genre.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Rename 修改类型的名称。如果 slug 随之发生变化，旧的 slug 会成为别名，并且在同一个事务中把所有使用该类型的影片（包括回收站中的影片）
+// 改写为新的 slug，这些影片的版本号都会加一并记录新版本。返回受影响的影片数量。
+func (m GenreModel) Rename(genre *Genre, name string, userID int64) (int64, error) {
+	slug := GenreSlug(name)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	err = lockGenres(ctx, tx, genre)
+	if err != nil {
+		return 0, err
+	}
+
+	var affected int64
+
+	if slug != genre.Slug {
+		err = checkGenreNames(ctx, tx, genre.ID, []string{slug})
+		if err != nil {
+			return 0, err
+		}
+
+		affected, err = rewriteMovieGenres(ctx, tx, `array_replace(genres, $1, $2)`, genre.Slug, slug, userID)
+		if err != nil {
+			return 0, err
+		}
+
+		// 新的 slug 原本可能就是这个类型的别名，此时需要把它从别名中去掉。
+		genre.Aliases = append(slices.DeleteFunc(genre.Aliases, func(alias string) bool { return alias == slug }), genre.Slug)
+	}
+
+	query := `
+		UPDATE genres
+		SET slug = $1, name = $2, aliases = $3
+		WHERE id = $4`
+
+	_, err = tx.ExecContext(ctx, query, slug, name, pqStringArray(genre.Aliases), genre.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	genre.Slug = slug
+	genre.Name = name
+
+	return affected, nil
+}
+
+// Merge 把 source 类型合并到 target 类型中：所有使用 source 的影片改为使用 target（已经同时使用两者的影片只保留 target），
+// source 的 slug 和别名成为 target 的别名，然后删除 source。与 Rename 一样，受影响影片的版本号都会加一。返回受影响的影片数量。
+func (m GenreModel) Merge(source, target *Genre, userID int64) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	err = lockGenres(ctx, tx, source, target)
+	if err != nil {
+		return 0, err
+	}
+
+	expr := `CASE WHEN genres @> ARRAY[$2] THEN array_remove(genres, $1) ELSE array_replace(genres, $1, $2) END`
+
+	affected, err := rewriteMovieGenres(ctx, tx, expr, source.Slug, target.Slug, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	target.Aliases = append(target.Aliases, source.Slug)
+	for _, alias := range source.Aliases {
+		if !slices.Contains(target.Aliases, alias) {
+			target.Aliases = append(target.Aliases, alias)
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM genres WHERE id = $1`, source.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE genres SET aliases = $1 WHERE id = $2`, pqStringArray(target.Aliases), target.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	return affected, tx.Commit()
+}
+
+// lockGenres() 在事务中使用 SELECT ... FOR UPDATE 锁定 genres 对应的行，直到事务结束，并检查它们在事务之外被读取之后有没有发生变化。
+// 按 id 的顺序加锁，避免两个并发的合并互相等待。任何一个类型已经被删除时返回 ErrRecordNotFound；slug 或别名被修改过时返回 ErrEditConflict。
+func lockGenres(ctx context.Context, tx *sql.Tx, genres ...*Genre) error {
+	ids := make([]int64, len(genres))
+	byID := make(map[int64]*Genre, len(genres))
+	for i, genre := range genres {
+		ids[i] = genre.ID
+		byID[genre.ID] = genre
+	}
+
+	query := `
+		SELECT id, slug, aliases
+		FROM genres
+		WHERE id = ANY($1)
+		ORDER BY id
+		FOR UPDATE`
+
+	rows, err := tx.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	locked := 0
+	changed := false
+
+	for rows.Next() {
+		var id int64
+		var slug string
+		var aliases []string
+
+		err := rows.Scan(&id, &slug, pq.Array(&aliases))
+		if err != nil {
+			return err
+		}
+
+		locked++
+		if genre := byID[id]; genre.Slug != slug || !slices.Equal(genre.Aliases, aliases) {
+			changed = true
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	switch {
+	case locked < len(byID):
+		return ErrRecordNotFound
+	case changed:
+		return ErrEditConflict
+	default:
+		return nil
+	}
+}
+
+// checkGenreNames() 检查 names 是否已经被 id 以外的类型用作 slug 或别名。
+func checkGenreNames(ctx context.Context, tx *sql.Tx, id int64, names []string) error {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM genres
+			WHERE id <> $1 AND (slug = ANY($2) OR aliases && $2)
+		)`
+
+	var exists bool
+
+	err := tx.QueryRowContext(ctx, query, id, pq.Array(names)).Scan(&exists)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return ErrDuplicateGenre
+	}
+	return nil
+}
+
+// rewriteMovieGenres() 用 expr 改写所有包含 $1 类型的影片的 genres，并把版本号加一。expr 中可以使用 $1（旧的 slug）和 $2（新的 slug）。
+// 与 MovieModel.Update() 一样，改写之前先补录影片的当前版本，改写之后再记录新版本，保证版本历史是连续的。
+func rewriteMovieGenres(ctx context.Context, tx *sql.Tx, expr, from, to string, userID int64) (int64, error) {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO movie_revisions (movie_id, version, title, year, run_time, genres, created_at)
+		SELECT id, version, title, year, run_time, genres, created_at
+		FROM movies
+		WHERE genres @> ARRAY[$1]
+		ON CONFLICT DO NOTHING`, from)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE movies
+		SET genres = `+expr+`, version = version + 1
+		WHERE genres @> ARRAY[$1]`, from, to)
+	if err != nil {
+		return 0, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO movie_revisions (movie_id, version, title, year, run_time, genres, user_id)
+		SELECT id, version, title, year, run_time, genres, $2
+		FROM movies
+		WHERE genres @> ARRAY[$1]
+		ON CONFLICT DO NOTHING`, to, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	return affected, nil
+}
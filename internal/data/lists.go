@@ -0,0 +1,397 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"greenlight.311102.xyz/internal/validator"
+	"time"
+)
+
+var (
+	ErrDuplicateListName = errors.New("duplicate list name")
+	ErrDuplicateListKind = errors.New("duplicate list kind")
+	ErrListOrderMismatch = errors.New("list order mismatch")
+)
+
+// ListKinds 是列表的类型。每个用户最多只能有一个 watchlist 和一个 favourites 列表。
+var ListKinds = []string{"watchlist", "favourites", "custom"}
+
+// List 是用户创建的影片列表。Public 为 false 时只有列表的所有者可以看到它。
+type List struct {
+	ID        int64       `json:"id"`
+	UserID    int64       `json:"user_id"`
+	Name      string      `json:"name"`
+	Kind      string      `json:"kind"`
+	Public    bool        `json:"public"`
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+	Version   int32       `json:"version"`
+	Items     []*ListItem `json:"items,omitempty"`
+}
+
+// ListItem 是列表中的一部影片，Position 从 1 开始。
+type ListItem struct {
+	Position int       `json:"position"`
+	AddedAt  time.Time `json:"added_at"`
+	Movie    *Movie    `json:"movie"`
+}
+
+func ValidateList(v *validator.Validator, list *List) {
+	v.Check(list.Name != "", "name", "must be provided")
+	v.Check(len(list.Name) <= 200, "name", "must not be more than 200 bytes long")
+	v.Check(validator.PermittedValue(list.Kind, ListKinds...), "kind", "must be one of watchlist, favourites or custom")
+}
+
+type ListModel struct {
+	DB *sql.DB
+}
+
+func (m ListModel) Insert(list *List) error {
+	query := `
+		INSERT INTO lists (user_id, name, kind, public)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, updated_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, list.UserID, list.Name, list.Kind, list.Public).Scan(
+		&list.ID,
+		&list.CreatedAt,
+		&list.UpdatedAt,
+		&list.Version,
+	)
+	if err != nil {
+		return listError(err)
+	}
+	return nil
+}
+
+func (m ListModel) Get(id int64) (*List, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, user_id, name, kind, public, created_at, updated_at, version
+		FROM lists
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var list List
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&list.ID,
+		&list.UserID,
+		&list.Name,
+		&list.Kind,
+		&list.Public,
+		&list.CreatedAt,
+		&list.UpdatedAt,
+		&list.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &list, nil
+}
+
+// GetAllForUser 分页返回用户的所有列表，不包含列表中的影片。
+func (m ListModel) GetAllForUser(userID int64, filters Filters) ([]*List, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, user_id, name, kind, public, created_at, updated_at, version
+		FROM lists
+		WHERE user_id = $1
+		ORDER BY %s %s, id ASC
+		LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	lists := []*List{}
+
+	for rows.Next() {
+		var list List
+		err := rows.Scan(
+			&totalRecords,
+			&list.ID,
+			&list.UserID,
+			&list.Name,
+			&list.Kind,
+			&list.Public,
+			&list.CreatedAt,
+			&list.UpdatedAt,
+			&list.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		lists = append(lists, &list)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return lists, metadata, nil
+}
+
+// Update 修改列表的名称和可见性，与影片一样使用 version 做乐观锁。列表的类型创建后不能修改。
+func (m ListModel) Update(list *List) error {
+	query := `
+		UPDATE lists
+		SET name = $1, public = $2, updated_at = NOW(), version = version + 1
+		WHERE id = $3 AND version = $4
+		RETURNING updated_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, list.Name, list.Public, list.ID, list.Version).Scan(&list.UpdatedAt, &list.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return listError(err)
+		}
+	}
+	return nil
+}
+
+func (m ListModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM lists
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetItems 按顺序返回列表中的影片。回收站中的影片不会出现在列表中，但恢复后会回到原来的位置。
+func (m ListModel) GetItems(listID int64) ([]*ListItem, error) {
+	query := `
+		SELECT list_items.position, list_items.added_at,
+		       movies.id, movies.created_at, movies.title, movies.year, movies.run_time, movies.genres, movies.version
+		FROM list_items
+		INNER JOIN movies ON movies.id = list_items.movie_id
+		WHERE list_items.list_id = $1 AND movies.deleted_at IS NULL
+		ORDER BY list_items.position ASC, list_items.added_at ASC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, listID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []*ListItem{}
+
+	for rows.Next() {
+		var item ListItem
+		var movie Movie
+
+		err := rows.Scan(
+			&item.Position,
+			&item.AddedAt,
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.RunTime,
+			pq.Array(&movie.Genres),
+			&movie.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		item.Movie = &movie
+		items = append(items, &item)
+	}
+
+	return items, rows.Err()
+}
+
+// AddItem 把影片追加到列表末尾。影片已经在列表中时什么也不做，并保持它原来的位置，因此重复调用是安全的。
+// 计算末尾位置之前先锁定列表，否则同时追加的两部影片可能得到相同的位置。
+func (m ListModel) AddItem(listID, movieID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `SELECT id FROM lists WHERE id = $1 FOR UPDATE`, listID)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO list_items (list_id, movie_id, position)
+		SELECT $1, $2, COALESCE(max(position), 0) + 1 FROM list_items WHERE list_id = $1
+		ON CONFLICT (list_id, movie_id) DO NOTHING`
+
+	_, err = tx.ExecContext(ctx, query, listID, movieID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m ListModel) RemoveItem(listID, movieID int64) error {
+	query := `
+		DELETE FROM list_items
+		WHERE list_id = $1 AND movie_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, listID, movieID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Reorder 按照 movieIDs 的顺序重新排列列表中的影片。movieIDs 必须恰好包含列表中所有未被删除的影片（即 GetItems() 返回的影片），
+// 否则返回 ErrListOrderMismatch。回收站中的影片排在重新排序的影片之后，并保持它们原来的相对顺序，这样恢复后它们会出现在列表末尾。
+// 结果只取决于 movieIDs，所以重复提交同样的顺序是安全的。整个操作在事务中完成，并锁定列表，避免与同时进行的重新排序交错。
+func (m ListModel) Reorder(listID int64, movieIDs []int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `SELECT id FROM lists WHERE id = $1 FOR UPDATE`, listID)
+	if err != nil {
+		return err
+	}
+
+	var count int
+	query := `
+		SELECT count(*)
+		FROM list_items
+		INNER JOIN movies ON movies.id = list_items.movie_id
+		WHERE list_items.list_id = $1 AND movies.deleted_at IS NULL`
+
+	err = tx.QueryRowContext(ctx, query, listID).Scan(&count)
+	if err != nil {
+		return err
+	}
+
+	if count != len(movieIDs) {
+		return ErrListOrderMismatch
+	}
+
+	query = `
+		UPDATE list_items
+		SET position = o.position
+		FROM unnest($2::bigint[]) WITH ORDINALITY AS o(movie_id, position), movies
+		WHERE list_items.list_id = $1 AND list_items.movie_id = o.movie_id
+		AND movies.id = list_items.movie_id AND movies.deleted_at IS NULL`
+
+	result, err := tx.ExecContext(ctx, query, listID, pq.Array(movieIDs))
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	// 数量相同但包含了不在列表中（或已被删除）的影片时，更新的行数会少于 movieIDs 的长度。
+	if rowsAffected != int64(len(movieIDs)) {
+		return ErrListOrderMismatch
+	}
+
+	query = `
+		UPDATE list_items
+		SET position = $2 + t.rank
+		FROM (
+			SELECT list_items.movie_id, row_number() OVER (ORDER BY list_items.position, list_items.added_at) AS rank
+			FROM list_items
+			INNER JOIN movies ON movies.id = list_items.movie_id
+			WHERE list_items.list_id = $1 AND movies.deleted_at IS NOT NULL
+		) AS t
+		WHERE list_items.list_id = $1 AND list_items.movie_id = t.movie_id`
+
+	_, err = tx.ExecContext(ctx, query, listID, len(movieIDs))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// listError() 把违反唯一约束的错误转换为对应的自定义错误。
+func listError(err error) error {
+	switch {
+	case err.Error() == `pq: duplicate key value violates unique constraint "lists_user_id_name_key"`:
+		return ErrDuplicateListName
+	case err.Error() == `pq: duplicate key value violates unique constraint "lists_user_id_kind_key"`:
+		return ErrDuplicateListKind
+	default:
+		return err
+	}
+}
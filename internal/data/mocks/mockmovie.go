@@ -1,25 +1,72 @@
 package mocks
 
-import "greenlight.311102.xyz/internal/data"
+import (
+	"greenlight.311102.xyz/internal/data"
+	"time"
+)
 
 type MockMovieModel struct{}
 
-func (m MockMovieModel) Insert(movie *data.Movie) error {
+func (m MockMovieModel) Insert(movie *data.Movie, userID int64) error {
 	return nil
 }
 
-func (m MockMovieModel) Get(id int64) (*data.Movie, error) {
+func (m MockMovieModel) InsertMany(movies []*data.Movie, userID int64) error {
+	return nil
+}
+
+func (m MockMovieModel) Get(id int64, fields ...string) (*data.Movie, error) {
+	return nil, nil
+}
+
+func (m MockMovieModel) GetMany(ids []int64, fields ...string) ([]*data.Movie, error) {
 	return nil, nil
 }
 
-func (m MockMovieModel) Update(movie *data.Movie) error {
+func (m MockMovieModel) Update(movie *data.Movie, userID int64) error {
 	return nil
 }
 
-func (m MockMovieModel) Delete(id int64) error {
+func (m MockMovieModel) Delete(id int64, version int32) error {
 	return nil
 }
 
-func (m MockMovieModel) GetAll(title string, genres []string, filters data.Filters) ([]*data.Movie, data.Metadata, error) {
+func (m MockMovieModel) Restore(id int64) (*data.Movie, error) {
+	return nil, nil
+}
+
+func (m MockMovieModel) Purge(retention time.Duration) (map[int64]*data.Poster, error) {
+	return nil, nil
+}
+
+func (m MockMovieModel) GetAllDeleted(filters data.Filters) ([]*data.Movie, data.Metadata, error) {
 	return nil, data.Metadata{}, nil
 }
+
+func (m MockMovieModel) GetAll(movieFilters data.MovieFilters, filters data.Filters) ([]*data.Movie, data.Metadata, error) {
+	return nil, data.Metadata{}, nil
+}
+
+func (m MockMovieModel) Stream(movieFilters data.MovieFilters, filters data.Filters, fn func(movie *data.Movie) error) error {
+	return nil
+}
+
+func (m MockMovieModel) Facets(movieFilters data.MovieFilters, names []string) (data.Facets, error) {
+	return nil, nil
+}
+
+func (m MockMovieModel) Stats(movieFilters data.MovieFilters) (*data.MovieStats, error) {
+	return nil, nil
+}
+
+func (m MockMovieModel) FindDuplicates(movie *data.Movie) ([]int64, error) {
+	return nil, nil
+}
+
+func (m MockMovieModel) Merge(duplicateID, canonicalID, userID int64) (*data.Poster, error) {
+	return nil, nil
+}
+
+func (m MockMovieModel) Redirect(id int64) (int64, error) {
+	return 0, nil
+}
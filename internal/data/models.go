@@ -3,6 +3,7 @@ package data
 import (
 	"database/sql"
 	"errors"
+	"time"
 )
 
 var (
@@ -12,23 +13,50 @@ var (
 
 type Models struct {
 	Movies interface {
-		Insert(movie *Movie) error
-		Get(id int64) (*Movie, error)
-		Update(movie *Movie) error
-		Delete(id int64) error
-		GetAll(title string, genres []string, filters Filters) ([]*Movie, Metadata, error)
+		Insert(movie *Movie, userID int64) error
+		InsertMany(movies []*Movie, userID int64) error
+		Get(id int64, fields ...string) (*Movie, error)
+		GetMany(ids []int64, fields ...string) ([]*Movie, error)
+		Update(movie *Movie, userID int64) error
+		Delete(id int64, version int32) error
+		Restore(id int64) (*Movie, error)
+		Purge(retention time.Duration) (map[int64]*Poster, error)
+		GetAllDeleted(filters Filters) ([]*Movie, Metadata, error)
+		GetAll(movieFilters MovieFilters, filters Filters) ([]*Movie, Metadata, error)
+		Stream(movieFilters MovieFilters, filters Filters, fn func(movie *Movie) error) error
+		Facets(movieFilters MovieFilters, names []string) (Facets, error)
+		Stats(movieFilters MovieFilters) (*MovieStats, error)
+		FindDuplicates(movie *Movie) ([]int64, error)
+		Merge(duplicateID, canonicalID, userID int64) (*Poster, error)
+		Redirect(id int64) (int64, error)
 	}
-	Users       UserModel
-	Tokens      TokenModel
-	Permissions PermissionModel
+	MovieRevisions  MovieRevisionModel
+	Genres          GenreModel
+	Ratings         RatingModel
+	Reviews         ReviewModel
+	Lists           ListModel
+	People          PersonModel
+	Credits         CreditModel
+	Recommendations RecommendationModel
+	Users           UserModel
+	Tokens          TokenModel
+	Permissions     PermissionModel
 }
 
 func NewModels(db *sql.DB) Models {
 	return Models{
-		Movies:      MovieModel{DB: db},
-		Users:       UserModel{DB: db},
-		Tokens:      TokenModel{DB: db},
-		Permissions: PermissionModel{DB: db},
+		Movies:          MovieModel{DB: db},
+		MovieRevisions:  MovieRevisionModel{DB: db},
+		Genres:          GenreModel{DB: db},
+		Ratings:         RatingModel{DB: db},
+		Reviews:         ReviewModel{DB: db},
+		Lists:           ListModel{DB: db},
+		People:          PersonModel{DB: db},
+		Credits:         CreditModel{DB: db},
+		Recommendations: RecommendationModel{DB: db},
+		Users:           UserModel{DB: db},
+		Tokens:          TokenModel{DB: db},
+		Permissions:     PermissionModel{DB: db},
 	}
 }
 
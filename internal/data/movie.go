@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"github.com/lib/pq"
 	"greenlight.311102.xyz/internal/validator"
+	"strings"
 	"time"
 )
 
@@ -14,16 +15,22 @@ import (
 // 这对于 Go 的编码/Json 软件包来说是必不可少的。在将结构编码为 JSON 时，不会包含任何未导出的字段。
 // 用 struct 标记注释 Movie 结构，以控制键在 JSON 编码输出中的显示方式。
 type Movie struct {
-	ID        int64     `json:"id"`
-	CreatedAt time.Time `json:"-"`
-	Title     string    `json:"title"`
-	Year      int32     `json:"year,omitempty"`
-	RunTime   RunTime   `json:"run_time,omitempty"` // 播放时长 分钟单位 // 使用 Runtime 类型而不是 int32。请注意，"omitempty "指令仍然有效：如果 Runtime 字段的底层值为 0，那么它将被视为空字段并被省略--而我们刚刚创建的 MarshalJSON() 方法根本不会被调用。
-	Genres    []string  `json:"genres,omitempty"`   // 播放时长 分钟单位
-	Version   int32     `json:"version"`            // 版本号从 1 开始，每次更新电影信息时都会递增
+	ID        int64          `json:"id"`
+	CreatedAt time.Time      `json:"-"`
+	Title     string         `json:"title"`
+	Year      int32          `json:"year,omitempty"`
+	RunTime   RunTime        `json:"run_time,omitempty"`   // 播放时长 分钟单位 // 使用 Runtime 类型而不是 int32。请注意，"omitempty "指令仍然有效：如果 Runtime 字段的底层值为 0，那么它将被视为空字段并被省略--而我们刚刚创建的 MarshalJSON() 方法根本不会被调用。
+	Genres    []string       `json:"genres,omitempty"`     // 播放时长 分钟单位
+	Version   int32          `json:"version"`              // 版本号从 1 开始，每次更新电影信息时都会递增
+	DeletedAt *time.Time     `json:"deleted_at,omitempty"` // 影片被移入回收站的时间，未删除的影片为 nil
+	Highlight string         `json:"highlight,omitempty"`  // 按标题搜索时，标题中匹配部分使用 <b></b> 标记后的 HTML 片段
+	Rating    *RatingSummary `json:"rating,omitempty"`     // 用户评分的平均值和数量，只有查询影片时才会填充
+	Poster    *Poster        `json:"poster,omitempty"`     // 海报及缩略图，没有上传海报时为 nil
 }
 
-func ValidateMovie(v *validator.Validator, movie *Movie) {
+// ValidateMovie 校验影片的字段。genres 不为 nil 时，影片的类型会被规范化为类型表中的 slug（例如 "Sci-Fi" 和 "science fiction" 都会变成 "sci-fi"），
+// 类型表中不存在的类型会导致校验失败。
+func ValidateMovie(v *validator.Validator, movie *Movie, genres GenreLookup) {
 	v.Check(movie.Title != "", "title", "must be provided")
 	v.Check(len(movie.Title) <= 500, "title", "must not be more than 500 bytes long")
 
@@ -38,13 +45,20 @@ func ValidateMovie(v *validator.Validator, movie *Movie) {
 	v.Check(len(movie.Genres) >= 1, "genres", "must contain at least 1 genre")
 	v.Check(len(movie.Genres) <= 5, "genres", "must not contain more than 5 genres")
 	v.Check(validator.Unique(movie.Genres), "genres", "must not contain duplicate values")
+
+	if genres != nil && movie.Genres != nil {
+		normalized, unknown := genres.Normalize(movie.Genres)
+		v.Check(len(unknown) == 0, "genres", "must only contain known genres, unknown: "+strings.Join(unknown, ", "))
+		movie.Genres = normalized
+	}
 }
 
 type MovieModel struct {
 	DB *sql.DB
 }
 
-func (m MovieModel) Insert(movie *Movie) error {
+// Insert 插入一部新影片，并在同一个事务中把第一个版本记录到 movie_revisions 表中。userID 是创建影片的用户。
+func (m MovieModel) Insert(movie *Movie, userID int64) error {
 	query := `
 		INSERT INTO movies (title, year, run_time, genres) 
 		VALUES ($1, $2, $3, $4)
@@ -57,11 +71,113 @@ func (m MovieModel) Insert(movie *Movie) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	// 使用 QueryRow() 方法在连接池上执行 SQL 查询，将 args 片段作为变量参数传递，并将系统生成的 id、created_at 和版本值扫描到 movie 结构中。
-	return m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// 使用 QueryRow() 方法执行 SQL 查询，将 args 片段作为变量参数传递，并将系统生成的 id、created_at 和版本值扫描到 movie 结构中。
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+	if err != nil {
+		return err
+	}
+
+	err = insertRevision(ctx, tx, movie, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-func (m MovieModel) Get(id int64) (*Movie, error) {
+// InsertMany 使用 PostgreSQL 的 COPY 协议在一个事务中批量插入影片，比逐条执行 INSERT 快得多。与 Insert 一样，每部影片的第一个版本
+// 会在同一个事务中记录到 movie_revisions 表中，userID 是导入影片的用户。
+// COPY 不会返回系统生成的值，因此 ID 是预先从序列中分配的；成功后调用方传入的影片结构会被回填 ID 和版本号，但不包括 created_at。
+func (m MovieModel) InsertMany(movies []*Movie, userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// 如果事务已经提交，Rollback() 什么也不会做。
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `SELECT nextval(pg_get_serial_sequence('movies', 'id')) FROM generate_series(1, $1)`, len(movies))
+	if err != nil {
+		return err
+	}
+	ids := make([]int64, 0, len(movies))
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	err = copyIn(ctx, tx, pq.CopyIn("movies", "id", "title", "year", "run_time", "genres"), len(movies), func(i int) []any {
+		movie := movies[i]
+		return []any{ids[i], movie.Title, movie.Year, movie.RunTime, pq.Array(movie.Genres)}
+	})
+	if err != nil {
+		return err
+	}
+
+	err = copyIn(ctx, tx, pq.CopyIn("movie_revisions", "movie_id", "version", "title", "year", "run_time", "genres", "user_id"), len(movies), func(i int) []any {
+		movie := movies[i]
+		return []any{ids[i], 1, movie.Title, movie.Year, movie.RunTime, pq.Array(movie.Genres), userID}
+	})
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	for i, movie := range movies {
+		movie.ID = ids[i]
+		movie.Version = 1
+	}
+	return nil
+}
+
+// copyIn() 在事务中执行一条 COPY 语句，row(i) 返回第 i 行的值。
+func copyIn(ctx context.Context, tx *sql.Tx, query string, n int, row func(i int) []any) error {
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for i := 0; i < n; i++ {
+		_, err = stmt.ExecContext(ctx, row(i)...)
+		if err != nil {
+			return err
+		}
+	}
+
+	// 不带参数调用 Exec() 会把缓冲区中剩余的数据全部发送给数据库，并结束 COPY 操作。
+	_, err = stmt.ExecContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	return stmt.Close()
+}
+
+// Get 读取一部影片。与 GetAll 一样，fields 不为空时只查询这些字段对应的列（以及 id 和 version），
+// 并且只有在请求了 rating 字段时才会加载评分汇总。
+func (m MovieModel) Get(id int64, fields ...string) (*Movie, error) {
 	// 我们使用的 PostgreSQL bigserial 类型的电影 ID 默认从 1 开始自动递增，因此我们知道没有电影的 ID 值会小于 1。
 	// 为了避免不必要的数据库调用，我们采取了一个快捷方式，直接返回 ErrRecordNotFound 错误信息
 	if id < 1 {
@@ -75,10 +191,13 @@ func (m MovieModel) Get(id int64) (*Movie, error) {
 	SELECT pg_sleep(10), id, created_at, title, year, run_time, genres, version
 	FROM movies
 	WHERE id=$1`*/
-	query := `
-		SELECT id, created_at, title, year, run_time, genres, version
+	filters := Filters{Fields: fields}
+	columns := filters.movieColumns()
+
+	query := fmt.Sprintf(`
+		SELECT %s
 		FROM movies
-		WHERE id=$1`
+		WHERE id=$1 AND deleted_at IS NULL`, strings.Join(columns, ", "))
 
 	// 使用 context.WithTimeout() 函数创建一个 context.Context，其超时期限为 3 秒。
 	// 请注意，我们使用空的 context.Background() 作为 "父 "上下文。
@@ -90,13 +209,7 @@ func (m MovieModel) Get(id int64) (*Movie, error) {
 	// 使用 QueryRowContext() 方法执行查询，将带有截止日期的上下文作为第一个参数传递。
 	err := m.DB.QueryRowContext(ctx, query, id).Scan(
 		//&[]byte{}, // 测试用 对应上面的 pg_sleep() 注释掉
-		&movie.ID,
-		&movie.CreatedAt,
-		&movie.Title,
-		&movie.Year,
-		&movie.RunTime,
-		pq.Array(&movie.Genres),
-		&movie.Version,
+		movieScanDest(&movie, columns)...,
 	)
 
 	// 处理任何错误。如果没有找到匹配的影片，Scan() 将返回 sql.ErrNoRows 错误。我们会对此进行检查，并返回我们自定义的 ErrRecordNotFound 错误。
@@ -108,18 +221,73 @@ func (m MovieModel) Get(id int64) (*Movie, error) {
 			return nil, err
 		}
 	}
+
+	if filters.wantsField("rating") {
+		err = loadRatingSummaries(ctx, m.DB, []*Movie{&movie})
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &movie, nil
 }
 
-func (m MovieModel) Update(movie *Movie) error {
+// GetMany 在一次查询中读取 ids 中的所有影片，返回的顺序与 ids 的顺序无关。不存在（或在回收站中）的影片不会出现在结果中，
+// 调用者可以据此得知哪些 ID 没有找到。fields 的含义与 Get 相同。
+func (m MovieModel) GetMany(ids []int64, fields ...string) ([]*Movie, error) {
+	filters := Filters{Fields: fields}
+	columns := filters.movieColumns()
+
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM movies
+		WHERE id = ANY($1) AND deleted_at IS NULL`, strings.Join(columns, ", "))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	movies := []*Movie{}
+
+	for rows.Next() {
+		var movie Movie
+		err := rows.Scan(movieScanDest(&movie, columns)...)
+		if err != nil {
+			return nil, err
+		}
+
+		movies = append(movies, &movie)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if filters.wantsField("rating") {
+		err = loadRatingSummaries(ctx, m.DB, movies)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return movies, nil
+}
+
+// Update 使用乐观锁更新影片，并在同一个事务中把新版本记录到 movie_revisions 表中。userID 是修改影片的用户。
+func (m MovieModel) Update(movie *Movie, userID int64) error {
 	query := `
-		UPDATE movies SET title=$1, year=$2, run_time=$3, genres=$4, version=version + 1
-		WHERE id=$5 AND version = $6 RETURNING version`
+		UPDATE movies SET title=$1, year=$2, run_time=$3, genres=$4, poster=$5, version=version + 1
+		WHERE id=$6 AND version = $7 AND deleted_at IS NULL RETURNING version`
 	args := []any{
 		movie.Title,
 		movie.Year,
 		movie.RunTime,
 		pq.Array(movie.Genres),
+		movie.Poster,
 		movie.ID,
 		movie.Version,
 	}
@@ -127,7 +295,25 @@ func (m MovieModel) Update(movie *Movie) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.Version)
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// 早期通过 InsertMany() 批量导入的影片没有初始版本记录，修改之前先把当前版本补录进去，这样它就不会被覆盖掉。
+	// 如果该版本已经有记录，ON CONFLICT DO NOTHING 会让这条语句什么也不做。
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO movie_revisions (movie_id, version, title, year, run_time, genres, created_at)
+		SELECT id, version, title, year, run_time, genres, created_at
+		FROM movies
+		WHERE id=$1 AND version=$2
+		ON CONFLICT DO NOTHING`, movie.ID, movie.Version)
+	if err != nil {
+		return err
+	}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&movie.Version)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -136,17 +322,26 @@ func (m MovieModel) Update(movie *Movie) error {
 			return err
 		}
 	}
-	return nil
+
+	err = insertRevision(ctx, tx, movie, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-func (m MovieModel) Delete(id int64) error {
+// Delete 并不会真正删除影片，而是设置 deleted_at 字段，把影片移入回收站。回收站中的影片不会再出现在 Get() 和 GetAll() 的结果中，
+// 可以通过 Restore() 恢复，超过保留期限后由 Purge() 彻底删除。
+// version 大于 0 时只有影片的版本号与之相同才会删除，否则返回 ErrEditConflict 错误；version 为 0 时不检查版本号。
+func (m MovieModel) Delete(id int64, version int32) error {
 	if id < 1 {
 		return ErrRecordNotFound
 	}
 
-	query := `DELETE FROM movies WHERE id=$1`
+	query := `UPDATE movies SET deleted_at = NOW() WHERE id=$1 AND deleted_at IS NULL AND ($2 = 0 OR version = $2)`
 
-	result, err := m.DB.Exec(query, id)
+	result, err := m.DB.Exec(query, id, version)
 
 	if err != nil {
 		return err
@@ -157,33 +352,163 @@ func (m MovieModel) Delete(id int64) error {
 		return err
 	}
 
+	// 调用方在指定版本号之前已经确认过影片存在，所以这种情况下没有删除任何记录意味着影片已被修改。
 	if rowAffected == 0 {
+		if version > 0 {
+			return ErrEditConflict
+		}
 		return ErrRecordNotFound
 	}
 
 	return nil
 }
 
+// Restore 将回收站中的影片恢复，并返回恢复后的影片。如果影片不存在或者并不在回收站中，则返回 ErrRecordNotFound 错误。
+func (m MovieModel) Restore(id int64) (*Movie, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		UPDATE movies SET deleted_at = NULL
+		WHERE id=$1 AND deleted_at IS NOT NULL
+		RETURNING id, created_at, title, year, run_time, genres, version, poster`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var movie Movie
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&movie.ID,
+		&movie.CreatedAt,
+		&movie.Title,
+		&movie.Year,
+		&movie.RunTime,
+		pq.Array(&movie.Genres),
+		&movie.Version,
+		&movie.Poster,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &movie, nil
+}
+
+// Purge 彻底删除在回收站中停留时间超过 retention 的影片，并以影片 ID 为键返回被删除影片的海报（没有海报的影片对应 nil），
+// map 的长度就是被删除的记录数。与 Merge 一样，调用者应该在删除之后清理这些海报的文件。
+func (m MovieModel) Purge(retention time.Duration) (map[int64]*Poster, error) {
+	query := `DELETE FROM movies WHERE deleted_at < $1 RETURNING id, poster`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, time.Now().Add(-retention))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posters := make(map[int64]*Poster)
+
+	for rows.Next() {
+		var id int64
+		var poster *Poster
+
+		err := rows.Scan(&id, &poster)
+		if err != nil {
+			return nil, err
+		}
+		posters[id] = poster
+	}
+
+	return posters, rows.Err()
+}
+
+// GetAllDeleted 分页返回回收站中的影片。
+func (m MovieModel) GetAllDeleted(filters Filters) ([]*Movie, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, created_at, title, year, run_time, genres, version, poster, deleted_at
+		FROM movies
+		WHERE deleted_at IS NOT NULL
+		ORDER BY %s %s, id ASC
+		LIMIT $1 OFFSET $2`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	movies := []*Movie{}
+
+	for rows.Next() {
+		var movie Movie
+		err := rows.Scan(
+			&totalRecords,
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.RunTime,
+			pq.Array(&movie.Genres),
+			&movie.Version,
+			&movie.Poster,
+			&movie.DeletedAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		movies = append(movies, &movie)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return movies, metadata, nil
+}
+
 // GetAll 创建一个新的 GetAll() 方法，用于返回 movies Slice。虽然我们现在没有使用它们，但我们已将其设置为接受各种过滤器参数作为参数。
-func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*Movie, Metadata, error) {
+func (m MovieModel) GetAll(movieFilters MovieFilters, filters Filters) ([]*Movie, Metadata, error) {
+	// 客户端提供了游标时，改用键集分页。
+	if filters.Cursor != "" {
+		return m.getAllByCursor(movieFilters, filters)
+	}
+
 	// 支持全文搜索
 	// to_tsvector('simple', title) 函数接收一个电影标题并将其拆分成词目。我们指定的是 simple 配置，这意味着词目只是标题中单词的小写版本。
 	// 例如，电影标题 "The Breakfast Club（早餐俱乐部）"将被分割成词素 "breakfast""club""the"。
 	// 其他 "non-simple" 配置可能会对词目应用额外的规则，如删除常用词或应用特定语言的词干。
 	// plainto_tsquery('simple', $1) 函数接收搜索值，并将其转化为 PostgreSQL 全文搜索可以理解的格式化查询词。它对†搜索值进行规范化处理（再次使用简单配置），去掉所有特殊字符，并在单词之间插入和运算符 &。例如，搜索值 "The Club"的结果就是查询词 "the " & "club"。
 	// count(*) OVER() 视窗函数 在获取列表信息的同时查出总数信息
+	// 按 relevance 排序时，ORDER BY 使用的是 ts_rank 与三元组相似度之和，而不是某一列。
+	where, args := movieFilters.where()
+
+	columns := filters.movieColumns()
+
 	query := fmt.Sprintf(`
-		SELECT count(*) OVER(), id, created_at, title, year, run_time, genres, version
+		SELECT count(*) OVER(), %s, %s
 		FROM movies
-		WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
-		AND (genres @> $2 OR $2 = '{}')
+		WHERE %s
 		ORDER BY %s %s, id ASC
-		LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+		LIMIT $%d OFFSET $%d`, strings.Join(columns, ", "), movieFilters.headline(), where, movieFilters.orderBy(filters.sortColumn()), filters.sortDirection(), len(args)+1, len(args)+2)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	args := []any{title, pq.Array(genres), filters.limit(), filters.offset()}
+	args = append(args, filters.limit(), filters.offset())
 
 	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
@@ -201,9 +526,67 @@ func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*M
 
 	for rows.Next() {
 		var movie Movie
-		// 将该行的值扫描到 "Movie"结构中。请再次注意，我们在 genres 字段上使用了 pq.Array() 适配器。
+		// 将该行的值扫描到 "Movie"结构中。请再次注意，movieScanDest() 在 genres 字段上使用了 pq.Array() 适配器。
+		dest := append([]any{&totalRecords}, movieScanDest(&movie, columns)...)
+		err := rows.Scan(append(dest, &movie.Highlight)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		movies = append(movies, &movie)
+	}
+	// 当 rows.Next() 循环结束后，调用 rows.Err() 来获取迭代过程中遇到的任何错误。
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	if filters.wantsField("rating") {
+		err = loadRatingSummaries(ctx, m.DB, movies)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	// 同时返回上一页和下一页的游标，客户端可以从任意一页切换到键集分页。
+	// 按 relevance 排序时无法使用键集分页，movieCursor() 返回空字符串，元数据中也就不会出现游标。
+	if len(movies) > 0 {
+		if filters.offset()+len(movies) < totalRecords {
+			metadata.NextCursor = filters.movieCursor(movies[len(movies)-1], false)
+		}
+		if filters.Page > 1 {
+			metadata.PrevCursor = filters.movieCursor(movies[0], true)
+		}
+	}
+
+	return movies, metadata, nil
+}
+
+// Stream 使用与 GetAll() 相同的过滤和排序条件查询全部影片（不分页）。每扫描到一行就调用一次 fn，而不是先把全部结果放入内存。
+// 整个结果来自同一条 SELECT 语句，因此 PostgreSQL 保证它是一个一致的快照。fn 返回错误时会立即停止扫描并返回该错误。
+func (m MovieModel) Stream(movieFilters MovieFilters, filters Filters, fn func(movie *Movie) error) error {
+	where, args := movieFilters.where()
+
+	query := fmt.Sprintf(`
+		SELECT id, created_at, title, year, run_time, genres, version, poster
+		FROM movies
+		WHERE %s
+		ORDER BY %s %s, id ASC`, where, movieFilters.orderBy(filters.sortColumn()), filters.sortDirection())
+
+	// 导出整个目录需要的时间远超过其他查询，因此这里使用更长的超时时间。
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var movie Movie
 		err := rows.Scan(
-			&totalRecords,
 			&movie.ID,
 			&movie.CreatedAt,
 			&movie.Title,
@@ -211,19 +594,152 @@ func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*M
 			&movie.RunTime,
 			pq.Array(&movie.Genres),
 			&movie.Version,
+			&movie.Poster,
 		)
+		if err != nil {
+			return err
+		}
+
+		err = fn(&movie)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// getAllByCursor() 使用键集分页返回影片列表。与 LIMIT/OFFSET 不同，它直接根据游标中记录的排序列值和 id 定位起始位置，
+// 因此翻到多深的位置都不会变慢，在两次请求之间插入或删除记录也不会导致结果重复或遗漏。
+// 注意这里没有使用 count(*) OVER()，因为在键集条件下它只能统计剩余的记录数，而且统计本身就是我们想要避免的开销。
+func (m MovieModel) getAllByCursor(movieFilters MovieFilters, filters Filters) ([]*Movie, Metadata, error) {
+	c, err := decodeCursor(filters.Cursor)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	// id 始终是升序的第二排序键。如果是向前翻页（上一页），则比较运算符和排序方向全部反转，查询完成后再把结果倒过来。
+	columnOp, idOp := ">", ">"
+	columnDir, idDir := "ASC", "ASC"
+	if filters.sortDirection() == "DESC" {
+		columnOp, columnDir = "<", "DESC"
+	}
+	if c.Prev {
+		columnOp, idOp = reverseOperator(columnOp), reverseOperator(idOp)
+		columnDir, idDir = reverseDirection(columnDir), reverseDirection(idDir)
+	}
+
+	where, args := movieFilters.where()
+	n := len(args)
+
+	columns := filters.movieColumns()
+
+	query := fmt.Sprintf(`
+		SELECT %[10]s, %[11]s
+		FROM movies
+		WHERE %[1]s
+		AND (%[2]s %[3]s $%[7]d OR (%[2]s = $%[7]d AND id %[4]s $%[8]d))
+		ORDER BY %[2]s %[5]s, id %[6]s
+		LIMIT $%[9]d`, where, filters.sortColumn(), columnOp, idOp, columnDir, idDir, n+1, n+2, n+3,
+		strings.Join(columns, ", "), movieFilters.headline())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// 多查询一条记录，用来判断在当前方向上是否还有更多数据。
+	args = append(args, c.Value, c.ID, filters.limit()+1)
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	movies := []*Movie{}
+
+	for rows.Next() {
+		var movie Movie
+		err := rows.Scan(append(movieScanDest(&movie, columns), &movie.Highlight)...)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
 
 		movies = append(movies, &movie)
 	}
-	// 当 rows.Next() 循环结束后，调用 rows.Err() 来获取迭代过程中遇到的任何错误。
 	if err = rows.Err(); err != nil {
 		return nil, Metadata{}, err
 	}
 
-	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	hasMore := len(movies) > filters.limit()
+	if hasMore {
+		movies = movies[:filters.limit()]
+	}
+
+	if c.Prev {
+		for i, j := 0, len(movies)-1; i < j; i, j = i+1, j-1 {
+			movies[i], movies[j] = movies[j], movies[i]
+		}
+	}
+
+	if filters.wantsField("rating") {
+		err = loadRatingSummaries(ctx, m.DB, movies)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+	}
+
+	metadata := Metadata{PageSize: filters.PageSize}
+	if len(movies) > 0 {
+		// 沿着游标的方向，只有还有更多数据时才返回游标；而反方向上一定存在数据（我们就是从那里翻过来的）。
+		if hasMore || c.Prev {
+			metadata.NextCursor = filters.movieCursor(movies[len(movies)-1], false)
+		}
+		if hasMore || !c.Prev {
+			metadata.PrevCursor = filters.movieCursor(movies[0], true)
+		}
+	}
 
 	return movies, metadata, nil
 }
+
+// movieScanDest() 返回与 columns 中的列一一对应的扫描目标。
+func movieScanDest(movie *Movie, columns []string) []any {
+	dest := make([]any, len(columns))
+	for i, column := range columns {
+		switch column {
+		case "id":
+			dest[i] = &movie.ID
+		case "created_at":
+			dest[i] = &movie.CreatedAt
+		case "title":
+			dest[i] = &movie.Title
+		case "year":
+			dest[i] = &movie.Year
+		case "run_time":
+			dest[i] = &movie.RunTime
+		case "genres":
+			dest[i] = pq.Array(&movie.Genres)
+		case "version":
+			dest[i] = &movie.Version
+		case "poster":
+			dest[i] = &movie.Poster
+		default:
+			panic("unknown movie column: " + column)
+		}
+	}
+	return dest
+}
+
+func reverseOperator(op string) string {
+	if op == ">" {
+		return "<"
+	}
+	return ">"
+}
+
+func reverseDirection(dir string) string {
+	if dir == "ASC" {
+		return "DESC"
+	}
+	return "ASC"
+}
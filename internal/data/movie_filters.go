@@ -0,0 +1,174 @@
+package data
+
+import (
+	"fmt"
+	"github.com/lib/pq"
+	"greenlight.311102.xyz/internal/validator"
+	"strings"
+	"time"
+)
+
+// MovieFilters 保存影片列表（以及导出）可以使用的所有过滤条件。零值表示不使用对应的条件。
+type MovieFilters struct {
+	Title         string
+	Language      string     // 标题全文搜索使用的 PostgreSQL 文本搜索配置，为空时使用 simple
+	SearchMode    string     // 标题的匹配方式，SearchModes 中的一个，为空时使用 fulltext
+	Genres        []string   // 必须包含所有这些类型（@>）
+	GenresAny     []string   // 至少包含其中一个类型（&&）
+	GenresNone    []string   // 不能包含其中任何一个类型
+	YearMin       int        // 年份下限（含）
+	YearMax       int        // 年份上限（含）
+	RunTimeMin    int        // 播放时长下限（含），单位分钟
+	RunTimeMax    int        // 播放时长上限（含），单位分钟
+	CreatedAfter  *time.Time // 创建时间晚于（不含）
+	CreatedBefore *time.Time // 创建时间早于（不含）
+	Director      string     // 导演姓名，按全文搜索匹配
+	Cast          string     // 演员姓名，按全文搜索匹配
+}
+
+// SearchLanguages 是标题搜索允许使用的文本搜索配置。由于配置名会被直接拼接到 SQL 中，因此必须经过这个安全列表的检查。
+var SearchLanguages = []string{"simple", "english", "french", "german", "italian", "portuguese", "russian", "spanish"}
+
+// SearchModes 是标题的匹配方式。fulltext 只使用全文搜索；fuzzy 还会使用 pg_trgm 的相似度匹配，以容忍拼写错误（例如 "godfathr"），
+// 因此会匹配到更多的影片，需要客户端明确选择。
+var SearchModes = []string{"fulltext", "fuzzy"}
+
+// ValidateMovieFilters 校验过滤条件。与 ValidateMovie() 一样，genres 不为 nil 时，genres、genres_any 和 genres_none 中的值
+// 会被规范化为类型表中的 slug（影片中保存的是 slug，否则 "Sci-Fi" 这样的写法什么也匹配不到），类型表中不存在的类型会导致校验失败。
+func ValidateMovieFilters(v *validator.Validator, f *MovieFilters, genres GenreLookup) {
+	if f.Language != "" {
+		v.Check(validator.PermittedValue(f.Language, SearchLanguages...), "language", "invalid language value")
+	}
+	if f.SearchMode != "" {
+		v.Check(validator.PermittedValue(f.SearchMode, SearchModes...), "search_mode", "invalid search_mode value")
+	}
+
+	currentYear := time.Now().Year()
+
+	if f.YearMin != 0 {
+		v.Check(f.YearMin >= 1888 && f.YearMin <= currentYear, "year_min", "must be between 1888 and the current year")
+	}
+	if f.YearMax != 0 {
+		v.Check(f.YearMax >= 1888 && f.YearMax <= currentYear, "year_max", "must be between 1888 and the current year")
+	}
+	if f.YearMin != 0 && f.YearMax != 0 {
+		v.Check(f.YearMin <= f.YearMax, "year_min", "must not be greater than year_max")
+	}
+
+	if f.RunTimeMin != 0 {
+		v.Check(f.RunTimeMin > 0, "run_time_min", "must be a positive integer")
+	}
+	if f.RunTimeMax != 0 {
+		v.Check(f.RunTimeMax > 0, "run_time_max", "must be a positive integer")
+	}
+	if f.RunTimeMin > 0 && f.RunTimeMax > 0 {
+		v.Check(f.RunTimeMin <= f.RunTimeMax, "run_time_min", "must not be greater than run_time_max")
+	}
+
+	v.Check(validator.Unique(f.GenresAny), "genres_any", "must not contain duplicate values")
+	v.Check(validator.Unique(f.GenresNone), "genres_none", "must not contain duplicate values")
+
+	if genres != nil {
+		f.Genres = normalizeGenreFilter(v, "genres", f.Genres, genres)
+		f.GenresAny = normalizeGenreFilter(v, "genres_any", f.GenresAny, genres)
+		f.GenresNone = normalizeGenreFilter(v, "genres_none", f.GenresNone, genres)
+	}
+
+	if f.CreatedAfter != nil && f.CreatedBefore != nil {
+		v.Check(f.CreatedAfter.Before(*f.CreatedBefore), "created_after", "must be earlier than created_before")
+	}
+}
+
+// normalizeGenreFilter() 把过滤条件中的类型规范化为 slug，无法识别的类型作为 key 的错误记录到 v 中。
+func normalizeGenreFilter(v *validator.Validator, key string, values []string, genres GenreLookup) []string {
+	normalized, unknown := genres.Normalize(values)
+	v.Check(len(unknown) == 0, key, "must only contain known genres, unknown: "+strings.Join(unknown, ", "))
+	return normalized
+}
+
+// language() 返回经过安全列表检查的文本搜索配置。与 Filters.sortColumn() 一样，遇到不安全的值时直接 panic。
+func (f MovieFilters) language() string {
+	if f.Language == "" {
+		return "simple"
+	}
+	if !validator.PermittedValue(f.Language, SearchLanguages...) {
+		panic("unsafe language parameter: " + f.Language)
+	}
+	return f.Language
+}
+
+// rank() 返回标题与搜索词（$1）的相关度表达式，它由全文搜索的 ts_rank 和 pg_trgm 的三元组相似度相加而成，
+// 因此即使标题中有拼写错误，相似的标题也能获得较高的排名。
+func (f MovieFilters) rank() string {
+	return fmt.Sprintf(`(ts_rank(to_tsvector('%[1]s', title), plainto_tsquery('%[1]s', $1)) + similarity(title, $1))`, f.language())
+}
+
+// headline() 返回带有高亮标记的标题片段表达式，没有搜索词时返回空字符串。片段是 HTML：标题中的 &、<、> 和 " 会先被转义，
+// 这样只有 <b></b> 是标记，客户端可以直接把片段插入页面。
+func (f MovieFilters) headline() string {
+	escaped := `replace(replace(replace(replace(title, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&quot;')`
+	return fmt.Sprintf(`CASE WHEN $1 = '' THEN '' ELSE ts_headline('%[1]s', %[2]s, plainto_tsquery('%[1]s', $1)) END`, f.language(), escaped)
+}
+
+// orderBy() 将排序列名转换为 ORDER BY 中使用的表达式。relevance 并不是真正的列，需要替换为 rank() 表达式。
+func (f MovieFilters) orderBy(column string) string {
+	if column == "relevance" {
+		return f.rank()
+	}
+	return column
+}
+
+// where() 返回影片查询共用的 WHERE 条件及其参数。条件中的占位符从 $1 开始编号，调用方追加的参数应从 len(args)+1 开始编号。
+// 与之前一样，每个条件都写成 "(条件 OR 参数为零值)" 的形式，未提供的过滤条件不会产生任何影响。
+// 标题默认只使用全文搜索匹配；SearchMode 为 fuzzy 时，还会使用 pg_trgm 的 % 运算符进行相似度匹配，以容忍拼写错误（例如 "godfathr"）。
+func (f MovieFilters) where() (string, []any) {
+	clause := fmt.Sprintf(`
+		deleted_at IS NULL
+		AND (to_tsvector('%[1]s', title) @@ plainto_tsquery('%[1]s', $1) OR ($13 AND title %% $1) OR $1 = '')
+		AND (genres @> $2 OR $2 = '{}')
+		AND (genres && $3 OR $3 = '{}')
+		AND (NOT genres && $4 OR $4 = '{}')
+		AND (year >= $5 OR $5 = 0)
+		AND (year <= $6 OR $6 = 0)
+		AND (run_time >= $7 OR $7 = 0)
+		AND (run_time <= $8 OR $8 = 0)
+		AND (created_at > $9 OR $9 IS NULL)
+		AND (created_at < $10 OR $10 IS NULL)
+		AND (%[2]s OR $11 = '')
+		AND (%[3]s OR $12 = '')`, f.language(), creditExists("director", 11), creditExists("actor", 12))
+
+	args := []any{
+		f.Title,
+		pqStringArray(f.Genres),
+		pqStringArray(f.GenresAny),
+		pqStringArray(f.GenresNone),
+		f.YearMin,
+		f.YearMax,
+		f.RunTimeMin,
+		f.RunTimeMax,
+		f.CreatedAfter,
+		f.CreatedBefore,
+		f.Director,
+		f.Cast,
+		f.SearchMode == "fuzzy",
+	}
+
+	return clause, args
+}
+
+// creditExists() 返回一个 EXISTS 子查询，检查影片是否有担任 role 职务、并且姓名与第 n 个参数匹配的演职人员。
+func creditExists(role string, n int) string {
+	return fmt.Sprintf(`EXISTS (
+			SELECT 1 FROM movie_credits
+			INNER JOIN people ON people.id = movie_credits.person_id
+			WHERE movie_credits.movie_id = movies.id AND movie_credits.role = '%s'
+			AND to_tsvector('simple', people.name) @@ plainto_tsquery('simple', $%d))`, role, n)
+}
+
+// pqStringArray() 与 pq.Array() 相同，但会把 nil 切片转换为空数组 '{}' 而不是 NULL，这样 "OR $n = '{}'" 条件才能生效。
+func pqStringArray(values []string) any {
+	if values == nil {
+		values = []string{}
+	}
+	return pq.Array(values)
+}
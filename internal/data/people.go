@@ -0,0 +1,414 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"greenlight.311102.xyz/internal/validator"
+	"time"
+)
+
+var ErrDuplicateCredit = errors.New("duplicate credit")
+
+// CreditRoles 是影片演职人员可以担任的职务。
+var CreditRoles = []string{"director", "actor", "writer"}
+
+// ExternalIDs 保存人物在其他数据库中的 ID，键是数据库的名称（例如 imdb），值是对应的 ID。它在数据库中保存为 jsonb。
+type ExternalIDs map[string]string
+
+// Value 实现 driver.Valuer 接口，nil 保存为空对象 '{}'。
+func (e ExternalIDs) Value() (driver.Value, error) {
+	if e == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(e)
+}
+
+// Scan 实现 sql.Scanner 接口，把 jsonb 解析为 ExternalIDs。
+func (e *ExternalIDs) Scan(src any) error {
+	b, ok := src.([]byte)
+	if !ok {
+		return fmt.Errorf("cannot scan %T into ExternalIDs", src)
+	}
+	return json.Unmarshal(b, e)
+}
+
+// Person 是参与影片制作的人物，例如导演、演员或编剧。
+type Person struct {
+	ID          int64       `json:"id"`
+	CreatedAt   time.Time   `json:"-"`
+	Name        string      `json:"name"`
+	BirthYear   int32       `json:"birth_year,omitempty"`
+	ExternalIDs ExternalIDs `json:"external_ids,omitempty"`
+	Version     int32       `json:"version"`
+}
+
+func ValidatePerson(v *validator.Validator, person *Person) {
+	v.Check(person.Name != "", "name", "must be provided")
+	v.Check(len(person.Name) <= 500, "name", "must not be more than 500 bytes long")
+
+	if person.BirthYear != 0 {
+		v.Check(person.BirthYear >= 1800, "birth_year", "must be greater than 1800")
+		v.Check(person.BirthYear <= int32(time.Now().Year()), "birth_year", "must not be in the future")
+	}
+
+	v.Check(len(person.ExternalIDs) <= 10, "external_ids", "must not contain more than 10 entries")
+	for key, value := range person.ExternalIDs {
+		v.Check(key != "" && len(key) <= 50, "external_ids", "keys must be between 1 and 50 bytes long")
+		v.Check(value != "" && len(value) <= 100, "external_ids", "values must be between 1 and 100 bytes long")
+	}
+}
+
+type PersonModel struct {
+	DB *sql.DB
+}
+
+func (m PersonModel) Insert(person *Person) error {
+	query := `
+		INSERT INTO people (name, birth_year, external_ids)
+		VALUES ($1, NULLIF($2, 0), $3)
+		RETURNING id, created_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, person.Name, person.BirthYear, person.ExternalIDs).Scan(
+		&person.ID,
+		&person.CreatedAt,
+		&person.Version,
+	)
+}
+
+func (m PersonModel) Get(id int64) (*Person, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, created_at, name, COALESCE(birth_year, 0), external_ids, version
+		FROM people
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var person Person
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&person.ID,
+		&person.CreatedAt,
+		&person.Name,
+		&person.BirthYear,
+		&person.ExternalIDs,
+		&person.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &person, nil
+}
+
+// Update 使用乐观锁修改人物信息。
+func (m PersonModel) Update(person *Person) error {
+	query := `
+		UPDATE people
+		SET name = $1, birth_year = NULLIF($2, 0), external_ids = $3, version = version + 1
+		WHERE id = $4 AND version = $5
+		RETURNING version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, person.Name, person.BirthYear, person.ExternalIDs, person.ID, person.Version).Scan(&person.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete 删除人物，他（她）在所有影片中的演职信息也会一起被删除。
+func (m PersonModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM people
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetAll 分页返回人物列表，name 不为空时按姓名进行全文搜索，与影片的标题搜索相同。
+func (m PersonModel) GetAll(name string, filters Filters) ([]*Person, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, created_at, name, COALESCE(birth_year, 0), external_ids, version
+		FROM people
+		WHERE (to_tsvector('simple', name) @@ plainto_tsquery('simple', $1) OR $1 = '')
+		ORDER BY %s %s, id ASC
+		LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, name, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	people := []*Person{}
+
+	for rows.Next() {
+		var person Person
+		err := rows.Scan(
+			&totalRecords,
+			&person.ID,
+			&person.CreatedAt,
+			&person.Name,
+			&person.BirthYear,
+			&person.ExternalIDs,
+			&person.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		people = append(people, &person)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return people, metadata, nil
+}
+
+// Credit 是人物在影片中担任的一个职务。在影片的演职人员列表中填充 Person，在人物的作品列表中填充 Movie。
+type Credit struct {
+	ID        int64   `json:"id"`
+	MovieID   int64   `json:"movie_id"`
+	PersonID  int64   `json:"person_id"`
+	Role      string  `json:"role"`
+	Character string  `json:"character,omitempty"` // 演员饰演的角色，其他职务为空
+	Person    *Person `json:"person,omitempty"`
+	Movie     *Movie  `json:"movie,omitempty"`
+}
+
+func ValidateCredit(v *validator.Validator, credit *Credit) {
+	v.Check(credit.PersonID > 0, "person_id", "must be provided")
+	v.Check(validator.PermittedValue(credit.Role, CreditRoles...), "role", "must be one of director, actor or writer")
+	v.Check(len(credit.Character) <= 500, "character", "must not be more than 500 bytes long")
+	if credit.Role != "actor" {
+		v.Check(credit.Character == "", "character", "must only be provided for actors")
+	}
+}
+
+type CreditModel struct {
+	DB *sql.DB
+}
+
+func (m CreditModel) Insert(credit *Credit) error {
+	query := `
+		INSERT INTO movie_credits (movie_id, person_id, role, character)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, credit.MovieID, credit.PersonID, credit.Role, credit.Character).Scan(&credit.ID)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "movie_credits_unique_key"`:
+			return ErrDuplicateCredit
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete 删除影片的一条演职信息。同时检查 movie_id，避免通过其他影片的地址删除。
+func (m CreditModel) Delete(movieID, id int64) error {
+	if movieID < 1 || id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM movie_credits
+		WHERE movie_id = $1 AND id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, movieID, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetAllForMovie 返回影片的所有演职人员，导演和编剧排在演员前面。
+func (m CreditModel) GetAllForMovie(movieID int64) ([]*Credit, error) {
+	credits, err := m.GetAllForMovies([]int64{movieID})
+	if err != nil {
+		return nil, err
+	}
+
+	if credits[movieID] == nil {
+		return []*Credit{}, nil
+	}
+	return credits[movieID], nil
+}
+
+// GetAllForMovies 在一次查询中读取多部影片的演职人员，按影片 ID 分组返回，每部影片的排序与 GetAllForMovie 相同。
+// 没有演职人员的影片不会出现在结果中。
+func (m CreditModel) GetAllForMovies(movieIDs []int64) (map[int64][]*Credit, error) {
+	query := `
+		SELECT movie_credits.id, movie_credits.movie_id, movie_credits.person_id, movie_credits.role, movie_credits.character,
+		       people.id, people.created_at, people.name, COALESCE(people.birth_year, 0), people.external_ids, people.version
+		FROM movie_credits
+		INNER JOIN people ON people.id = movie_credits.person_id
+		WHERE movie_credits.movie_id = ANY($1)
+		ORDER BY array_position(ARRAY['director', 'writer', 'actor'], movie_credits.role), movie_credits.id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(movieIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	credits := make(map[int64][]*Credit, len(movieIDs))
+
+	for rows.Next() {
+		var credit Credit
+		var person Person
+
+		err := rows.Scan(
+			&credit.ID,
+			&credit.MovieID,
+			&credit.PersonID,
+			&credit.Role,
+			&credit.Character,
+			&person.ID,
+			&person.CreatedAt,
+			&person.Name,
+			&person.BirthYear,
+			&person.ExternalIDs,
+			&person.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		credit.Person = &person
+		credits[credit.MovieID] = append(credits[credit.MovieID], &credit)
+	}
+
+	return credits, rows.Err()
+}
+
+// GetAllForPerson 分页返回人物的作品列表（filmography），回收站中的影片不包含在内。
+func (m CreditModel) GetAllForPerson(personID int64, filters Filters) ([]*Credit, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), movie_credits.id, movie_credits.movie_id, movie_credits.person_id, movie_credits.role, movie_credits.character,
+		       movies.id, movies.created_at, movies.title, movies.year, movies.run_time, movies.genres, movies.version
+		FROM movie_credits
+		INNER JOIN movies ON movies.id = movie_credits.movie_id
+		WHERE movie_credits.person_id = $1 AND movies.deleted_at IS NULL
+		ORDER BY movies.%s %s, movie_credits.id ASC
+		LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, personID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	credits := []*Credit{}
+
+	for rows.Next() {
+		var credit Credit
+		var movie Movie
+
+		err := rows.Scan(
+			&totalRecords,
+			&credit.ID,
+			&credit.MovieID,
+			&credit.PersonID,
+			&credit.Role,
+			&credit.Character,
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.RunTime,
+			pq.Array(&movie.Genres),
+			&movie.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		credit.Movie = &movie
+		credits = append(credits, &credit)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return credits, metadata, nil
+}
@@ -0,0 +1,30 @@
+package data
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// Poster 是影片海报。URL 指向原图，Thumbnails 以尺寸名称（例如 small）为键保存各个缩略图的地址。
+// 它在数据库中保存为 jsonb。
+type Poster struct {
+	URL        string            `json:"url"`
+	Width      int               `json:"width"`
+	Height     int               `json:"height"`
+	Thumbnails map[string]string `json:"thumbnails,omitempty"`
+}
+
+// Value 实现 driver.Valuer 接口。Movie.Poster 为 nil 时 database/sql 不会调用这个方法，而是直接保存为 NULL。
+func (p Poster) Value() (driver.Value, error) {
+	return json.Marshal(p)
+}
+
+// Scan 实现 sql.Scanner 接口。扫描到 **Poster 时，database/sql 会把 NULL 转换为 nil，只有非 NULL 的值才会调用这个方法。
+func (p *Poster) Scan(src any) error {
+	b, ok := src.([]byte)
+	if !ok {
+		return fmt.Errorf("cannot scan %T into Poster", src)
+	}
+	return json.Unmarshal(b, p)
+}
@@ -0,0 +1,139 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/lib/pq"
+	"strings"
+	"time"
+)
+
+// Recommendation 是相似影片或推荐结果中的一部影片。Score 表示匹配程度，范围为 0 到 1，越大越匹配。
+type Recommendation struct {
+	*Movie
+	Score float64 `json:"score"`
+}
+
+type RecommendationModel struct {
+	DB *sql.DB
+}
+
+// Similar 返回与 movie 至少有一个相同类型的其他影片，按相似度从高到低排列。相似度由三部分加权组成：
+// 类型的重合程度（交集与并集之比，权重 0.6）、上映年份的接近程度（权重 0.25）和播放时长的接近程度（权重 0.15）。
+func (m RecommendationModel) Similar(movie *Movie, filters Filters) ([]*Recommendation, Metadata, error) {
+	query := `
+		SELECT count(*) OVER(), %s, score
+		FROM (
+			SELECT *, round((
+				0.6 * cardinality(ARRAY(SELECT unnest(genres) INTERSECT SELECT unnest($2::text[])))
+				    / cardinality(ARRAY(SELECT unnest(genres) UNION SELECT unnest($2::text[])))::float8
+				+ 0.25 / (1 + abs(year - $3) / 5.0)
+				+ 0.15 / (1 + abs(run_time - $4) / 30.0)
+			)::numeric, 3)::float8 AS score
+			FROM movies
+			WHERE id <> $1 AND genres && $2 AND deleted_at IS NULL
+		) AS candidates
+		ORDER BY score DESC, id ASC
+		LIMIT $5 OFFSET $6`
+
+	args := []any{movie.ID, pq.Array(movie.Genres), movie.Year, movie.RunTime, filters.limit(), filters.offset()}
+
+	return m.query(query, args, filters)
+}
+
+// ForUser 根据用户自己的评分和列表为用户推荐影片。用户评过分或加入过列表的影片是推荐的依据：
+// 评分减去 5 作为权重（低分会降低同类影片的得分），favourites、watchlist 和自定义列表中的影片权重分别为 4、2 和 1。
+// 每个类型的偏好是依据影片中包含该类型的权重之和，候选影片的得分由它所属类型的偏好（权重 0.8）和其他用户的评分（权重 0.2）组成。
+// 依据影片本身不会被推荐。用户还没有任何评分和列表时，结果只取决于其他用户的评分。
+func (m RecommendationModel) ForUser(userID int64, filters Filters) ([]*Recommendation, Metadata, error) {
+	query := `
+		WITH seeds AS (
+			SELECT movie_id, score - 5 AS weight
+			FROM ratings
+			WHERE user_id = $1
+			UNION ALL
+			SELECT list_items.movie_id, CASE lists.kind WHEN 'favourites' THEN 4 WHEN 'watchlist' THEN 2 ELSE 1 END
+			FROM list_items
+			INNER JOIN lists ON lists.id = list_items.list_id
+			WHERE lists.user_id = $1
+		),
+		affinity AS (
+			SELECT genre, sum(seeds.weight)::float8 AS weight
+			FROM seeds
+			INNER JOIN movies ON movies.id = seeds.movie_id
+			CROSS JOIN unnest(movies.genres) AS genre
+			GROUP BY genre
+		),
+		profile AS (
+			SELECT greatest(coalesce(sum(weight) FILTER (WHERE weight > 0), 0), 1) AS total
+			FROM affinity
+		),
+		community AS (
+			SELECT movie_id, avg(score) AS average, count(*) AS ratings
+			FROM ratings
+			GROUP BY movie_id
+		)
+		SELECT count(*) OVER(), %s, score
+		FROM (
+			SELECT movies.*, round((
+				0.8 * greatest(coalesce((SELECT sum(affinity.weight) FROM affinity WHERE affinity.genre = ANY(movies.genres)), 0), 0) / profile.total
+				+ 0.2 * coalesce(community.average / 10 * least(community.ratings, 10) / 10.0, 0)
+			)::numeric, 3)::float8 AS score
+			FROM movies
+			CROSS JOIN profile
+			LEFT JOIN community ON community.movie_id = movies.id
+			WHERE movies.deleted_at IS NULL
+			AND NOT EXISTS (SELECT 1 FROM seeds WHERE seeds.movie_id = movies.id)
+		) AS candidates
+		ORDER BY score DESC, id ASC
+		LIMIT $2 OFFSET $3`
+
+	args := []any{userID, filters.limit(), filters.offset()}
+
+	return m.query(query, args, filters)
+}
+
+// query() 执行 Similar() 和 ForUser() 的查询。query 中的 %s 会被替换为影片的全部列，最后一列必须是 score。
+func (m RecommendationModel) query(query string, args []any, filters Filters) ([]*Recommendation, Metadata, error) {
+	// 推荐结果不支持稀疏字段集，总是查询影片的全部列。
+	columns := Filters{}.movieColumns()
+	query = fmt.Sprintf(query, strings.Join(columns, ", "))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	recommendations := []*Recommendation{}
+	movies := []*Movie{}
+
+	for rows.Next() {
+		recommendation := Recommendation{Movie: &Movie{}}
+		dest := append([]any{&totalRecords}, movieScanDest(recommendation.Movie, columns)...)
+		err := rows.Scan(append(dest, &recommendation.Score)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		recommendations = append(recommendations, &recommendation)
+		movies = append(movies, recommendation.Movie)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	err = loadRatingSummaries(ctx, m.DB, movies)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return recommendations, metadata, nil
+}
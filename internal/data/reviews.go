@@ -0,0 +1,374 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"greenlight.311102.xyz/internal/validator"
+	"time"
+)
+
+var ErrDuplicateReview = errors.New("duplicate review")
+
+// RatingSummary 是影片所有评分的汇总，作为 Movie 的 rating 字段返回。
+type RatingSummary struct {
+	Average float64 `json:"average"`
+	Count   int     `json:"count"`
+}
+
+// Rating 是某个用户对某部影片的评分，取值为 1 到 10。
+type Rating struct {
+	MovieID   int64     `json:"movie_id"`
+	UserID    int64     `json:"user_id"`
+	Score     int       `json:"score"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func ValidateRating(v *validator.Validator, rating *Rating) {
+	v.Check(rating.Score >= 1 && rating.Score <= 10, "score", "must be between 1 and 10")
+}
+
+type RatingModel struct {
+	DB *sql.DB
+}
+
+// Upsert 创建或修改用户对影片的评分。同一个用户重复评分时只会覆盖之前的分数，因此这个操作是幂等的。
+func (m RatingModel) Upsert(rating *Rating) error {
+	query := `
+		INSERT INTO ratings (movie_id, user_id, score)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (movie_id, user_id) DO UPDATE SET score = EXCLUDED.score, updated_at = NOW()
+		RETURNING created_at, updated_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, rating.MovieID, rating.UserID, rating.Score).Scan(&rating.CreatedAt, &rating.UpdatedAt)
+}
+
+// Delete 删除用户对影片的评分。
+func (m RatingModel) Delete(movieID, userID int64) error {
+	query := `
+		DELETE FROM ratings
+		WHERE movie_id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, movieID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Summary 返回影片当前的评分汇总。
+func (m RatingModel) Summary(movieID int64) (*RatingSummary, error) {
+	query := `
+		SELECT COALESCE(round(avg(score), 1), 0)::float8, count(*)
+		FROM ratings
+		WHERE movie_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var summary RatingSummary
+
+	err := m.DB.QueryRowContext(ctx, query, movieID).Scan(&summary.Average, &summary.Count)
+	if err != nil {
+		return nil, err
+	}
+
+	return &summary, nil
+}
+
+// loadRatingSummaries() 为一组影片填充评分汇总。汇总是在读取时直接根据 ratings 表计算的，而不是在 movies 表中维护冗余的计数，
+// 这样并发的评分操作之间不需要任何协调，读到的汇总也总是与 ratings 表一致。
+func loadRatingSummaries(ctx context.Context, db *sql.DB, movies []*Movie) error {
+	if len(movies) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(movies))
+	byID := make(map[int64]*Movie, len(movies))
+	for i, movie := range movies {
+		ids[i] = movie.ID
+		byID[movie.ID] = movie
+		movie.Rating = &RatingSummary{}
+	}
+
+	query := `
+		SELECT movie_id, round(avg(score), 1)::float8, count(*)
+		FROM ratings
+		WHERE movie_id = ANY($1)
+		GROUP BY movie_id`
+
+	rows, err := db.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var movieID int64
+		var summary RatingSummary
+
+		err := rows.Scan(&movieID, &summary.Average, &summary.Count)
+		if err != nil {
+			return err
+		}
+
+		byID[movieID].Rating = &summary
+	}
+
+	return rows.Err()
+}
+
+// Review 是用户为影片撰写的影评。
+type Review struct {
+	ID        int64     `json:"id"`
+	MovieID   int64     `json:"movie_id"`
+	UserID    int64     `json:"user_id"`
+	UserName  string    `json:"user_name"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Version   int32     `json:"version"`
+}
+
+func ValidateReview(v *validator.Validator, review *Review) {
+	v.Check(review.Body != "", "body", "must be provided")
+	v.Check(len(review.Body) <= 10_000, "body", "must not be more than 10000 bytes long")
+}
+
+type ReviewModel struct {
+	DB *sql.DB
+}
+
+// Insert 创建一篇影评。每个用户对每部影片只能写一篇影评，重复创建时返回 ErrDuplicateReview。
+func (m ReviewModel) Insert(review *Review) error {
+	query := `
+		INSERT INTO reviews (movie_id, user_id, body)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at, updated_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, review.MovieID, review.UserID, review.Body).Scan(
+		&review.ID,
+		&review.CreatedAt,
+		&review.UpdatedAt,
+		&review.Version,
+	)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "reviews_movie_id_user_id_key"`:
+			return ErrDuplicateReview
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Get 返回影片下的某一篇影评。同时检查 movie_id，避免通过其他影片的地址访问到这篇影评。
+func (m ReviewModel) Get(movieID, id int64) (*Review, error) {
+	if movieID < 1 || id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT reviews.id, reviews.movie_id, reviews.user_id, users.name, reviews.body,
+		       reviews.created_at, reviews.updated_at, reviews.version
+		FROM reviews
+		INNER JOIN users ON users.id = reviews.user_id
+		WHERE reviews.movie_id = $1 AND reviews.id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var review Review
+
+	err := m.DB.QueryRowContext(ctx, query, movieID, id).Scan(
+		&review.ID,
+		&review.MovieID,
+		&review.UserID,
+		&review.UserName,
+		&review.Body,
+		&review.CreatedAt,
+		&review.UpdatedAt,
+		&review.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &review, nil
+}
+
+// Update 修改影评内容，与影片一样使用 version 做乐观锁。
+func (m ReviewModel) Update(review *Review) error {
+	query := `
+		UPDATE reviews
+		SET body = $1, updated_at = NOW(), version = version + 1
+		WHERE id = $2 AND version = $3
+		RETURNING updated_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, review.Body, review.ID, review.Version).Scan(&review.UpdatedAt, &review.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (m ReviewModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM reviews
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetAllForMovie 分页返回影片的影评。
+func (m ReviewModel) GetAllForMovie(movieID int64, filters Filters) ([]*Review, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), reviews.id, reviews.movie_id, reviews.user_id, users.name, reviews.body,
+		       reviews.created_at, reviews.updated_at, reviews.version
+		FROM reviews
+		INNER JOIN users ON users.id = reviews.user_id
+		WHERE reviews.movie_id = $1
+		ORDER BY reviews.%s %s, reviews.id ASC
+		LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	reviews := []*Review{}
+
+	for rows.Next() {
+		var review Review
+		err := rows.Scan(
+			&totalRecords,
+			&review.ID,
+			&review.MovieID,
+			&review.UserID,
+			&review.UserName,
+			&review.Body,
+			&review.CreatedAt,
+			&review.UpdatedAt,
+			&review.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		reviews = append(reviews, &review)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return reviews, metadata, nil
+}
+
+// GetLatestForMovies 在一次查询中读取多部影片各自最新的 limit 篇影评，按影片 ID 分组返回，每部影片的影评从新到旧排列。
+func (m ReviewModel) GetLatestForMovies(movieIDs []int64, limit int) (map[int64][]*Review, error) {
+	query := `
+		SELECT r.id, r.movie_id, r.user_id, users.name, r.body, r.created_at, r.updated_at, r.version
+		FROM (
+			SELECT *, row_number() OVER (PARTITION BY movie_id ORDER BY created_at DESC, id ASC) AS n
+			FROM reviews
+			WHERE movie_id = ANY($1)
+		) AS r
+		INNER JOIN users ON users.id = r.user_id
+		WHERE r.n <= $2
+		ORDER BY r.movie_id, r.created_at DESC, r.id ASC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(movieIDs), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reviews := make(map[int64][]*Review, len(movieIDs))
+
+	for rows.Next() {
+		var review Review
+		err := rows.Scan(
+			&review.ID,
+			&review.MovieID,
+			&review.UserID,
+			&review.UserName,
+			&review.Body,
+			&review.CreatedAt,
+			&review.UpdatedAt,
+			&review.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		reviews[review.MovieID] = append(reviews[review.MovieID], &review)
+	}
+
+	return reviews, rows.Err()
+}
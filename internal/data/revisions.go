@@ -0,0 +1,197 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"slices"
+	"time"
+)
+
+// MovieRevision 保存影片某一个版本的完整内容，以及是谁、在什么时候产生了这个版本。
+// ChangedBy 为 nil 表示无法确定修改者（例如批量导入的影片，或者对应的用户已被删除）。
+type MovieRevision struct {
+	MovieID   int64     `json:"movie_id"`
+	Version   int32     `json:"version"`
+	Title     string    `json:"title"`
+	Year      int32     `json:"year,omitempty"`
+	RunTime   RunTime   `json:"run_time,omitempty"`
+	Genres    []string  `json:"genres,omitempty"`
+	ChangedBy *int64    `json:"changed_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// FieldDiff 描述某个字段在两个版本之间的变化。
+type FieldDiff struct {
+	From any `json:"from"`
+	To   any `json:"to"`
+}
+
+// Diff 逐个字段比较该版本与给定影片（通常是当前版本），只返回发生了变化的字段。
+func (r *MovieRevision) Diff(movie *Movie) map[string]FieldDiff {
+	diff := make(map[string]FieldDiff)
+
+	if r.Title != movie.Title {
+		diff["title"] = FieldDiff{From: r.Title, To: movie.Title}
+	}
+	if r.Year != movie.Year {
+		diff["year"] = FieldDiff{From: r.Year, To: movie.Year}
+	}
+	if r.RunTime != movie.RunTime {
+		diff["run_time"] = FieldDiff{From: r.RunTime, To: movie.RunTime}
+	}
+	if !slices.Equal(r.Genres, movie.Genres) {
+		diff["genres"] = FieldDiff{From: r.Genres, To: movie.Genres}
+	}
+
+	return diff
+}
+
+// insertRevision() 在给定的事务中记录影片的当前版本。它由 MovieModel 的 Insert() 和 Update() 调用，以保证影片和版本记录同时写入。
+func insertRevision(ctx context.Context, tx *sql.Tx, movie *Movie, userID int64) error {
+	query := `
+		INSERT INTO movie_revisions (movie_id, version, title, year, run_time, genres, user_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+	args := []any{movie.ID, movie.Version, movie.Title, movie.Year, movie.RunTime, pq.Array(movie.Genres), userID}
+
+	_, err := tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+type MovieRevisionModel struct {
+	DB *sql.DB
+}
+
+// Get 返回影片的某一个版本。
+func (m MovieRevisionModel) Get(movieID int64, version int32) (*MovieRevision, error) {
+	if movieID < 1 || version < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT movie_id, version, title, year, run_time, genres, user_id, created_at
+		FROM movie_revisions
+		WHERE movie_id=$1 AND version=$2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var revision MovieRevision
+
+	err := m.DB.QueryRowContext(ctx, query, movieID, version).Scan(
+		&revision.MovieID,
+		&revision.Version,
+		&revision.Title,
+		&revision.Year,
+		&revision.RunTime,
+		pq.Array(&revision.Genres),
+		&revision.ChangedBy,
+		&revision.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &revision, nil
+}
+
+// GetAllForMovie 分页返回影片的所有版本记录。
+func (m MovieRevisionModel) GetAllForMovie(movieID int64, filters Filters) ([]*MovieRevision, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), movie_id, version, title, year, run_time, genres, user_id, created_at
+		FROM movie_revisions
+		WHERE movie_id=$1
+		ORDER BY %s %s
+		LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	revisions := []*MovieRevision{}
+
+	for rows.Next() {
+		var revision MovieRevision
+		err := rows.Scan(
+			&totalRecords,
+			&revision.MovieID,
+			&revision.Version,
+			&revision.Title,
+			&revision.Year,
+			&revision.RunTime,
+			pq.Array(&revision.Genres),
+			&revision.ChangedBy,
+			&revision.CreatedAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		revisions = append(revisions, &revision)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return revisions, metadata, nil
+}
+
+// GetLatestForMovies 在一次查询中读取多部影片各自最新的 limit 个版本记录，按影片 ID 分组返回，每部影片的版本从新到旧排列。
+func (m MovieRevisionModel) GetLatestForMovies(movieIDs []int64, limit int) (map[int64][]*MovieRevision, error) {
+	query := `
+		SELECT movie_id, version, title, year, run_time, genres, user_id, created_at
+		FROM (
+			SELECT *, row_number() OVER (PARTITION BY movie_id ORDER BY version DESC) AS n
+			FROM movie_revisions
+			WHERE movie_id = ANY($1)
+		) AS r
+		WHERE n <= $2
+		ORDER BY movie_id, version DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(movieIDs), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := make(map[int64][]*MovieRevision, len(movieIDs))
+
+	for rows.Next() {
+		var revision MovieRevision
+		err := rows.Scan(
+			&revision.MovieID,
+			&revision.Version,
+			&revision.Title,
+			&revision.Year,
+			&revision.RunTime,
+			pq.Array(&revision.Genres),
+			&revision.ChangedBy,
+			&revision.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		revisions[revision.MovieID] = append(revisions[revision.MovieID], &revision)
+	}
+
+	return revisions, rows.Err()
+}
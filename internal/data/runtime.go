@@ -3,6 +3,8 @@ package data
 import (
 	"errors"
 	"fmt"
+	"math"
+	"regexp"
 	"strconv"
 	"strings"
 )
@@ -12,7 +14,96 @@ var ErrInvalidRunTimeFormat = errors.New("invalid runtime format")
 
 type RunTime int32
 
+// RunTime 支持的输出格式。RunTimeMins 是默认格式，与之前的响应保持一致。
+const (
+	RunTimeMins    = "mins"    // "102 mins"
+	RunTimeMinutes = "minutes" // 102
+	RunTimeHours   = "hours"   // "1h 42m"
+	RunTimeISO8601 = "iso8601" // "PT1H42M"
+)
+
+var RunTimeFormats = []string{RunTimeMins, RunTimeMinutes, RunTimeHours, RunTimeISO8601}
+
+var (
+	// "PT1H42M"、"PT102M"、"PT6120S"，不区分大小写。
+	runTimeISO8601RX = regexp.MustCompile(`^pt(?:(\d+)h)?(?:(\d+)m)?(?:(\d+)s)?$`)
+	// "1h 42m"、"1h42m"、"2 hours"、"102 min"、"102 mins"、"102m"，不区分大小写。
+	runTimeHumanRX = regexp.MustCompile(`^(?:(\d+)\s*(?:h|hr|hrs|hour|hours))?\s*(?:(\d+)\s*(?:m|min|mins|minute|minutes))?$`)
+)
+
+// ParseRunTime 把字符串解析为 RunTime，支持纯数字（分钟数）、"102 mins"、"102 min"、"1h 42m" 和 ISO 8601 时长（例如 "PT1H42M"）。
+// ISO 8601 时长中的秒数必须能凑成整分钟。
+func ParseRunTime(s string) (RunTime, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+
+	if i, err := strconv.ParseInt(s, 10, 32); err == nil {
+		return RunTime(i), nil
+	}
+
+	var hours, minutes, seconds string
+
+	if m := runTimeISO8601RX.FindStringSubmatch(s); m != nil {
+		hours, minutes, seconds = m[1], m[2], m[3]
+	} else if m := runTimeHumanRX.FindStringSubmatch(s); m != nil {
+		hours, minutes = m[1], m[2]
+	}
+
+	if hours == "" && minutes == "" && seconds == "" {
+		return 0, ErrInvalidRunTimeFormat
+	}
+
+	total := int64(0)
+	for _, part := range []struct {
+		value  string
+		factor int64
+	}{{hours, 3600}, {minutes, 60}, {seconds, 1}} {
+		if part.value == "" {
+			continue
+		}
+		i, err := strconv.ParseInt(part.value, 10, 32)
+		if err != nil {
+			return 0, ErrInvalidRunTimeFormat
+		}
+		total += i * part.factor
+	}
+
+	if total%60 != 0 || total/60 > math.MaxInt32 {
+		return 0, ErrInvalidRunTimeFormat
+	}
+
+	return RunTime(total / 60), nil
+}
+
+// Format 返回 RunTime 在指定格式下的 JSON 值。未知的格式使用默认的 RunTimeMins 格式。
+func (r RunTime) Format(format string) any {
+	switch format {
+	case RunTimeMinutes:
+		return int32(r)
+	case RunTimeHours:
+		switch {
+		case r < 60:
+			return fmt.Sprintf("%dm", r)
+		case r%60 == 0:
+			return fmt.Sprintf("%dh", r/60)
+		default:
+			return fmt.Sprintf("%dh %dm", r/60, r%60)
+		}
+	case RunTimeISO8601:
+		switch {
+		case r < 60:
+			return fmt.Sprintf("PT%dM", r)
+		case r%60 == 0:
+			return fmt.Sprintf("PT%dH", r/60)
+		default:
+			return fmt.Sprintf("PT%dH%dM", r/60, r%60)
+		}
+	default:
+		return fmt.Sprintf("%d mins", r)
+	}
+}
+
 // MarshalJSON 在 Runtime 类型上实现 MarshalJSON() 方法，使其满足 json.Marshaler 接口。该方法将返回电影运行时的 JSON 编码值（在我们的例子中，它将返回格式为"<runtime> mins "的字符串）。
+// 其他输出格式请使用 Format()。
 func (r RunTime) MarshalJSON() ([]byte, error) {
 	jsonValue := fmt.Sprintf("%d mins", r)
 	// 在字符串上使用 strconv.Quote() 函数，用双引号将其包住。要成为有效的 JSON 字符串，必须用双引号将其包围。
@@ -23,25 +114,29 @@ func (r RunTime) MarshalJSON() ([]byte, error) {
 // UnmarshalJSON 在 RunTime 类型上实现 UnmarshalJSON() 方法，使其满足 json.Unmarshaler 接口。重要：由于 UnmarshalJSON() 需要修改接收器（我们的 RunTime 类型），因此我们必须使用指针接收器才能正常工作。否则，我们只能修改一个副本（该副本会在此方法返回时被丢弃）。
 // Go 在解码 JSON 时，会检查目标类型是否满足 json.Unmarshaler 接口。如果满足接口，Go 将调用 UnmarshalJSON() 方法来确定如何将提供的 JSON 解码为目标类型。这基本上是 json.Marshaler 接口的反向操作，我们之前使用该接口定制了 JSON 编码行为。
 func (r *RunTime) UnmarshalJSON(jsonValue []byte) error {
-	// 我们预计传入的 JSON 值将是一个格式为"<runtime> mins "的字符串，我们首先要做的就是从这个字符串中移除周围的双引号。如果无法取消引号，我们就会返回 ErrInvalidRuntimeFormat 错误。
+	// JSON 数字直接作为分钟数，但必须是整数。
+	if len(jsonValue) > 0 && jsonValue[0] != '"' {
+		i, err := strconv.ParseInt(string(jsonValue), 10, 32)
+		if err != nil {
+			return ErrInvalidRunTimeFormat
+		}
+		*r = RunTime(i)
+		return nil
+	}
+
+	// 否则传入的 JSON 值应该是一个字符串，我们首先要做的就是从这个字符串中移除周围的双引号。如果无法取消引号，我们就会返回 ErrInvalidRuntimeFormat 错误。
 	unquotedJSONValue, err := strconv.Unquote(string(jsonValue))
 	if err != nil {
 		return ErrInvalidRunTimeFormat
 	}
-	// 分割字符串，分离出包含数字的部分。
-	parts := strings.Split(unquotedJSONValue, " ")
-	// 对字符串的各部分进行理智检查，确保其符合预期格式。如果不是，我们将再次返回 ErrInvalidRuntimeFormat 错误。
-	if len(parts) != 2 || parts[1] != "mins" {
-		return ErrInvalidRunTimeFormat
-	}
-	// 否则，将包含数字的字符串解析为 int32。同样，如果解析失败，将返回 ErrInvalidRuntimeFormat 错误。
-	i, err := strconv.ParseInt(parts[0], 10, 32)
+
+	runTime, err := ParseRunTime(unquotedJSONValue)
 	if err != nil {
-		return ErrInvalidRunTimeFormat
+		return err
 	}
-	// 将 int32 转换为 RunTime 类型，并将其赋值给接收器。
+
 	// 请注意，我们使用运算符来替换接收器（接收器是指向运行时类型的指针），以便设置指针的底层值。
 	// 直接替换 *r 这个内存地址对应的值为 RunTime(i)
-	*r = RunTime(i)
+	*r = runTime
 	return nil
 }
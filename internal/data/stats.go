@@ -0,0 +1,111 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// MovieStats 是一组影片的汇总统计。播放时长的单位都是分钟，保留一位小数。
+type MovieStats struct {
+	Total          int           `json:"total"`
+	AverageRunTime float64       `json:"average_run_time"`
+	MedianRunTime  float64       `json:"median_run_time"`
+	Genres         []GenreStats  `json:"genres"`
+	Decades        []DecadeStats `json:"decades"`
+	GeneratedAt    time.Time     `json:"generated_at"`
+}
+
+// GenreStats 是某个类型下影片的数量和播放时长。一部影片有多个类型时，它会在每个类型下各计算一次。
+type GenreStats struct {
+	Genre          string  `json:"genre"`
+	Count          int     `json:"count"`
+	AverageRunTime float64 `json:"average_run_time"`
+	MedianRunTime  float64 `json:"median_run_time"`
+}
+
+// DecadeStats 是某个年代（例如 1990 表示 1990 到 1999 年）上映的影片数量。
+type DecadeStats struct {
+	Decade int `json:"decade"`
+	Count  int `json:"count"`
+}
+
+// Stats 为给定的过滤条件计算汇总统计。与 Facets 一样，过滤条件来自 MovieFilters.where()，统计结果不受分页和排序影响。
+func (m MovieModel) Stats(movieFilters MovieFilters) (*MovieStats, error) {
+	where, args := movieFilters.where()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	stats := &MovieStats{
+		Genres:      []GenreStats{},
+		Decades:     []DecadeStats{},
+		GeneratedAt: time.Now(),
+	}
+
+	query := fmt.Sprintf(`
+		SELECT count(*),
+		       coalesce(round(avg(run_time), 1), 0)::float8,
+		       coalesce(round(percentile_cont(0.5) WITHIN GROUP (ORDER BY run_time)::numeric, 1), 0)::float8
+		FROM movies
+		WHERE %s`, where)
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&stats.Total, &stats.AverageRunTime, &stats.MedianRunTime)
+	if err != nil {
+		return nil, err
+	}
+
+	query = fmt.Sprintf(`
+		SELECT g.genre, count(*),
+		       round(avg(run_time), 1)::float8,
+		       round(percentile_cont(0.5) WITHIN GROUP (ORDER BY run_time)::numeric, 1)::float8
+		FROM movies, unnest(genres) AS g(genre)
+		WHERE %s
+		GROUP BY g.genre
+		ORDER BY count(*) DESC, g.genre ASC`, where)
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var gs GenreStats
+		err := rows.Scan(&gs.Genre, &gs.Count, &gs.AverageRunTime, &gs.MedianRunTime)
+		if err != nil {
+			return nil, err
+		}
+		stats.Genres = append(stats.Genres, gs)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	query = fmt.Sprintf(`
+		SELECT year / 10 * 10, count(*)
+		FROM movies
+		WHERE %s
+		GROUP BY year / 10
+		ORDER BY year / 10 ASC`, where)
+
+	rows, err = m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ds DecadeStats
+		err := rows.Scan(&ds.Decade, &ds.Count)
+		if err != nil {
+			return nil, err
+		}
+		stats.Decades = append(stats.Decades, ds)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,275 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ErrTestFailed 在 JSON Patch 的 test 操作不满足时返回。按照 RFC 6902 的要求，此时整个补丁都不会被应用。
+var ErrTestFailed = errors.New("test operation failed")
+
+// Operation 是 RFC 6902 JSON Patch 中的一个操作。目前支持 add、remove、replace 和 test。
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// Merge 将 RFC 7386 JSON Merge Patch 应用到 doc 上，并返回合并后的文档。
+// 补丁中值为 null 的成员会从文档中删除，对象会被递归合并，其他任何值（包括数组）都会直接替换原来的值。
+func Merge(doc, patch []byte) ([]byte, error) {
+	var target, p any
+
+	err := json.Unmarshal(doc, &target)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(patch, &p)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(mergeValue(target, p))
+}
+
+func mergeValue(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = make(map[string]any)
+	}
+
+	for key, value := range p {
+		if value == nil {
+			delete(t, key)
+			continue
+		}
+		t[key] = mergeValue(t[key], value)
+	}
+
+	return t
+}
+
+// Apply 将 RFC 6902 JSON Patch 中的操作依次应用到 doc 上，并返回修改后的文档。任何一个操作失败都会返回错误，并且不会返回部分修改的结果。
+func Apply(doc, patch []byte) ([]byte, error) {
+	var target any
+
+	err := json.Unmarshal(doc, &target)
+	if err != nil {
+		return nil, err
+	}
+
+	var ops []Operation
+	err = json.Unmarshal(patch, &ops)
+	if err != nil {
+		return nil, errors.New("patch must be an array of operations")
+	}
+
+	for i, op := range ops {
+		target, err = apply(target, op)
+		if err != nil {
+			if errors.Is(err, ErrTestFailed) {
+				return nil, fmt.Errorf("operation %d: %w", i, err)
+			}
+			return nil, fmt.Errorf("operation %d (%s %q): %w", i, op.Op, op.Path, err)
+		}
+	}
+
+	return json.Marshal(target)
+}
+
+func apply(doc any, op Operation) (any, error) {
+	tokens, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var value any
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return nil, errors.New("missing value")
+		}
+		err = json.Unmarshal(op.Value, &value)
+		if err != nil {
+			return nil, err
+		}
+	case "remove":
+	default:
+		return nil, fmt.Errorf("unsupported op %q", op.Op)
+	}
+
+	// 路径为空字符串时，操作的是整个文档。
+	if len(tokens) == 0 {
+		switch op.Op {
+		case "add", "replace":
+			return value, nil
+		case "test":
+			if !reflect.DeepEqual(doc, value) {
+				return nil, ErrTestFailed
+			}
+			return doc, nil
+		default:
+			return nil, errors.New("cannot remove the whole document")
+		}
+	}
+
+	return update(doc, tokens, func(container any, key string) (any, error) {
+		switch op.Op {
+		case "add":
+			return add(container, key, value)
+		case "remove":
+			return remove(container, key)
+		case "replace":
+			return replace(container, key, value)
+		default:
+			current, err := get(container, key)
+			if err != nil {
+				return nil, err
+			}
+			if !reflect.DeepEqual(current, value) {
+				return nil, ErrTestFailed
+			}
+			return container, nil
+		}
+	})
+}
+
+// parsePointer() 将 RFC 6901 JSON Pointer 解析为路径片段，并处理 ~1（/）和 ~0（~）转义。
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, errors.New("path must start with '/'")
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(tokens[i], "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// update() 沿着路径找到目标位置的父容器，调用 fn 得到修改后的父容器，然后逐层写回。
+// 之所以需要写回，是因为向切片中插入或删除元素会得到一个新的切片。
+func update(node any, tokens []string, fn func(container any, key string) (any, error)) (any, error) {
+	if len(tokens) == 1 {
+		return fn(node, tokens[0])
+	}
+
+	child, err := get(node, tokens[0])
+	if err != nil {
+		return nil, err
+	}
+
+	child, err = update(child, tokens[1:], fn)
+	if err != nil {
+		return nil, err
+	}
+
+	return replace(node, tokens[0], child)
+}
+
+func get(container any, key string) (any, error) {
+	switch c := container.(type) {
+	case map[string]any:
+		value, ok := c[key]
+		if !ok {
+			return nil, fmt.Errorf("member %q does not exist", key)
+		}
+		return value, nil
+	case []any:
+		i, err := arrayIndex(key, len(c)-1)
+		if err != nil {
+			return nil, err
+		}
+		return c[i], nil
+	default:
+		return nil, fmt.Errorf("cannot traverse into %q", key)
+	}
+}
+
+func add(container any, key string, value any) (any, error) {
+	switch c := container.(type) {
+	case map[string]any:
+		c[key] = value
+		return c, nil
+	case []any:
+		// "-" 表示追加到数组末尾。
+		if key == "-" {
+			return append(c, value), nil
+		}
+		i, err := arrayIndex(key, len(c))
+		if err != nil {
+			return nil, err
+		}
+		c = append(c, nil)
+		copy(c[i+1:], c[i:])
+		c[i] = value
+		return c, nil
+	default:
+		return nil, fmt.Errorf("cannot add %q to a non-container value", key)
+	}
+}
+
+func remove(container any, key string) (any, error) {
+	switch c := container.(type) {
+	case map[string]any:
+		if _, ok := c[key]; !ok {
+			return nil, fmt.Errorf("member %q does not exist", key)
+		}
+		delete(c, key)
+		return c, nil
+	case []any:
+		i, err := arrayIndex(key, len(c)-1)
+		if err != nil {
+			return nil, err
+		}
+		return append(c[:i], c[i+1:]...), nil
+	default:
+		return nil, fmt.Errorf("cannot remove %q from a non-container value", key)
+	}
+}
+
+func replace(container any, key string, value any) (any, error) {
+	switch c := container.(type) {
+	case map[string]any:
+		if _, ok := c[key]; !ok {
+			return nil, fmt.Errorf("member %q does not exist", key)
+		}
+		c[key] = value
+		return c, nil
+	case []any:
+		i, err := arrayIndex(key, len(c)-1)
+		if err != nil {
+			return nil, err
+		}
+		c[i] = value
+		return c, nil
+	default:
+		return nil, fmt.Errorf("cannot replace %q in a non-container value", key)
+	}
+}
+
+// arrayIndex() 解析数组下标，并检查它是否在 [0, max] 范围内。RFC 6901 不允许带前导零的下标。
+func arrayIndex(key string, max int) (int, error) {
+	if key == "" || (len(key) > 1 && key[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", key)
+	}
+
+	i, err := strconv.Atoi(key)
+	if err != nil || i < 0 || i > max {
+		return 0, fmt.Errorf("array index %q out of bounds", key)
+	}
+	return i, nil
+}
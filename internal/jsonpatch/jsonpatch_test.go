@@ -0,0 +1,317 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// jsonEqual() 比较两个 JSON 文档是否表示相同的值，忽略对象成员的顺序和空白。
+func jsonEqual(t *testing.T, got []byte, want string) bool {
+	t.Helper()
+
+	var g, w any
+	if err := json.Unmarshal(got, &g); err != nil {
+		t.Fatalf("invalid result %s: %v", got, err)
+	}
+	if err := json.Unmarshal([]byte(want), &w); err != nil {
+		t.Fatalf("invalid expected value %s: %v", want, err)
+	}
+	return reflect.DeepEqual(g, w)
+}
+
+// TestApply 使用 RFC 6902 附录 A 中的示例，以及一些额外的边界情况。
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string // 期望的结果，为空表示期望返回错误
+	}{
+		{
+			name:  "A.1 adding an object member",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/baz", "value": "qux"}]`,
+			want:  `{"baz": "qux", "foo": "bar"}`,
+		},
+		{
+			name:  "A.2 adding an array element",
+			doc:   `{"foo": ["bar", "baz"]}`,
+			patch: `[{"op": "add", "path": "/foo/1", "value": "qux"}]`,
+			want:  `{"foo": ["bar", "qux", "baz"]}`,
+		},
+		{
+			name:  "A.3 removing an object member",
+			doc:   `{"baz": "qux", "foo": "bar"}`,
+			patch: `[{"op": "remove", "path": "/baz"}]`,
+			want:  `{"foo": "bar"}`,
+		},
+		{
+			name:  "A.4 removing an array element",
+			doc:   `{"foo": ["bar", "qux", "baz"]}`,
+			patch: `[{"op": "remove", "path": "/foo/1"}]`,
+			want:  `{"foo": ["bar", "baz"]}`,
+		},
+		{
+			name:  "A.5 replacing a value",
+			doc:   `{"baz": "qux", "foo": "bar"}`,
+			patch: `[{"op": "replace", "path": "/baz", "value": "boo"}]`,
+			want:  `{"baz": "boo", "foo": "bar"}`,
+		},
+		{
+			// move 和 copy 操作目前不受支持。
+			name:  "A.6 moving a value",
+			doc:   `{"foo": {"bar": "baz", "waldo": "fred"}, "qux": {"corge": "grault"}}`,
+			patch: `[{"op": "move", "from": "/foo/waldo", "path": "/qux/thud"}]`,
+		},
+		{
+			name:  "A.7 moving an array element",
+			doc:   `{"foo": ["all", "grass", "cows", "eat"]}`,
+			patch: `[{"op": "move", "from": "/foo/1", "path": "/foo/3"}]`,
+		},
+		{
+			name: "A.8 testing a value: success",
+			doc:  `{"baz": "qux", "foo": ["a", 2, "c"]}`,
+			patch: `[
+				{"op": "test", "path": "/baz", "value": "qux"},
+				{"op": "test", "path": "/foo/1", "value": 2}
+			]`,
+			want: `{"baz": "qux", "foo": ["a", 2, "c"]}`,
+		},
+		{
+			name:  "A.9 testing a value: error",
+			doc:   `{"baz": "qux"}`,
+			patch: `[{"op": "test", "path": "/baz", "value": "bar"}]`,
+		},
+		{
+			name:  "A.10 adding a nested member object",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/child", "value": {"grandchild": {}}}]`,
+			want:  `{"foo": "bar", "child": {"grandchild": {}}}`,
+		},
+		{
+			name:  "A.11 ignoring unrecognized elements",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/baz", "value": "qux", "xyz": 123}]`,
+			want:  `{"foo": "bar", "baz": "qux"}`,
+		},
+		{
+			name:  "A.12 adding to a nonexistent target",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/baz/bat", "value": "qux"}]`,
+		},
+		{
+			name:  "A.13 invalid JSON patch document",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/baz", "value": "qux", "op": "remove"}]`,
+		},
+		{
+			name: "A.14 ~ escape ordering",
+			doc:  `{"/": 9, "~1": 10}`,
+			patch: `[
+				{"op": "test", "path": "/~01", "value": 10},
+				{"op": "test", "path": "/~1", "value": 9}
+			]`,
+			want: `{"/": 9, "~1": 10}`,
+		},
+		{
+			name:  "A.15 comparing strings and numbers",
+			doc:   `{"/": 9, "~1": 10}`,
+			patch: `[{"op": "test", "path": "/~01", "value": "10"}]`,
+		},
+		{
+			name:  "A.16 adding an array value",
+			doc:   `{"foo": ["bar"]}`,
+			patch: `[{"op": "add", "path": "/foo/-", "value": ["abc", "def"]}]`,
+			want:  `{"foo": ["bar", ["abc", "def"]]}`,
+		},
+
+		{
+			name:  "append to an empty array",
+			doc:   `{"genres": []}`,
+			patch: `[{"op": "add", "path": "/genres/-", "value": "drama"}, {"op": "add", "path": "/genres/-", "value": "crime"}]`,
+			want:  `{"genres": ["drama", "crime"]}`,
+		},
+		{
+			name:  "add at the end of an array by index",
+			doc:   `{"genres": ["drama"]}`,
+			patch: `[{"op": "add", "path": "/genres/1", "value": "crime"}]`,
+			want:  `{"genres": ["drama", "crime"]}`,
+		},
+		{
+			name:  "remove the last element of an array",
+			doc:   `{"genres": ["drama", "crime"]}`,
+			patch: `[{"op": "remove", "path": "/genres/1"}]`,
+			want:  `{"genres": ["drama"]}`,
+		},
+		{
+			name:  "remove every element of an array",
+			doc:   `{"genres": ["drama", "crime"]}`,
+			patch: `[{"op": "remove", "path": "/genres/0"}, {"op": "remove", "path": "/genres/0"}]`,
+			want:  `{"genres": []}`,
+		},
+		{
+			name:  "remove from an array with -",
+			doc:   `{"genres": ["drama"]}`,
+			patch: `[{"op": "remove", "path": "/genres/-"}]`,
+		},
+		{
+			name:  "array index out of bounds",
+			doc:   `{"genres": ["drama"]}`,
+			patch: `[{"op": "add", "path": "/genres/2", "value": "crime"}]`,
+		},
+		{
+			name:  "array index with a leading zero",
+			doc:   `{"genres": ["drama", "crime"]}`,
+			patch: `[{"op": "replace", "path": "/genres/01", "value": "war"}]`,
+		},
+		{
+			name:  "escaped member names",
+			doc:   `{"a/b": 1, "m~n": 2}`,
+			patch: `[{"op": "replace", "path": "/a~1b", "value": 3}, {"op": "remove", "path": "/m~0n"}]`,
+			want:  `{"a/b": 3}`,
+		},
+		{
+			name: "test a nested value",
+			doc:  `{"movie": {"rating": {"average": 8.5, "count": 2}, "genres": ["drama"]}}`,
+			patch: `[
+				{"op": "test", "path": "/movie/rating", "value": {"count": 2, "average": 8.5}},
+				{"op": "test", "path": "/movie/genres", "value": ["drama"]},
+				{"op": "replace", "path": "/movie/rating/count", "value": 3}
+			]`,
+			want: `{"movie": {"rating": {"average": 8.5, "count": 3}, "genres": ["drama"]}}`,
+		},
+		{
+			name:  "test a nested value: error",
+			doc:   `{"movie": {"genres": ["drama", "crime"]}}`,
+			patch: `[{"op": "test", "path": "/movie/genres", "value": ["crime", "drama"]}]`,
+		},
+		{
+			name:  "test the whole document",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "test", "path": "", "value": {"foo": "bar"}}]`,
+			want:  `{"foo": "bar"}`,
+		},
+		{
+			name:  "replace the whole document",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "replace", "path": "", "value": ["baz"]}]`,
+			want:  `["baz"]`,
+		},
+		{
+			name:  "remove the whole document",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "remove", "path": ""}]`,
+		},
+		{
+			name:  "replace a missing member",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "replace", "path": "/baz", "value": "qux"}]`,
+		},
+		{
+			name:  "remove a missing member",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "remove", "path": "/baz"}]`,
+		},
+		{
+			name:  "missing value",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/baz"}]`,
+		},
+		{
+			name:  "path without a leading slash",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "baz", "value": "qux"}]`,
+		},
+		{
+			name:  "patch is not an array",
+			doc:   `{"foo": "bar"}`,
+			patch: `{"op": "add", "path": "/baz", "value": "qux"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Apply([]byte(tt.doc), []byte(tt.patch))
+
+			if tt.want == "" {
+				if err == nil {
+					t.Fatalf("want error; got %s", got)
+				}
+				if got != nil {
+					t.Errorf("want no partial result; got %s", got)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !jsonEqual(t, got, tt.want) {
+				t.Errorf("want %s; got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestApplyTestFailed(t *testing.T) {
+	_, err := Apply([]byte(`{"baz": "qux"}`), []byte(`[{"op": "test", "path": "/baz", "value": "bar"}]`))
+	if !errors.Is(err, ErrTestFailed) {
+		t.Errorf("want ErrTestFailed; got %v", err)
+	}
+}
+
+// TestMerge 使用 RFC 7386 附录 A 中的示例，以及一些额外的边界情况。
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		doc   string
+		patch string
+		want  string
+	}{
+		{`{"a": "b"}`, `{"a": "c"}`, `{"a": "c"}`},
+		{`{"a": "b"}`, `{"b": "c"}`, `{"a": "b", "b": "c"}`},
+		{`{"a": "b"}`, `{"a": null}`, `{}`},
+		{`{"a": "b", "b": "c"}`, `{"a": null}`, `{"b": "c"}`},
+		{`{"a": ["b"]}`, `{"a": "c"}`, `{"a": "c"}`},
+		{`{"a": "c"}`, `{"a": ["b"]}`, `{"a": ["b"]}`},
+		{`{"a": {"b": "c"}}`, `{"a": {"b": "d", "c": null}}`, `{"a": {"b": "d"}}`},
+		{`{"a": [{"b": "c"}]}`, `{"a": [1]}`, `{"a": [1]}`},
+		{`["a", "b"]`, `["c", "d"]`, `["c", "d"]`},
+		{`{"a": "b"}`, `["c"]`, `["c"]`},
+		{`{"a": "foo"}`, `null`, `null`},
+		{`{"a": "foo"}`, `"bar"`, `"bar"`},
+		{`{"e": null}`, `{"a": 1}`, `{"e": null, "a": 1}`},
+		{`[1, 2]`, `{"a": "b", "c": null}`, `{"a": "b"}`},
+		{`{}`, `{"a": {"bb": {"ccc": null}}}`, `{"a": {"bb": {}}}`},
+
+		{`{"title": "Moana", "year": 2016}`, `{"year": null, "missing": null}`, `{"title": "Moana"}`},
+		{`{"rating": {"average": 8.5, "count": 2}}`, `{"rating": {"count": null}}`, `{"rating": {"average": 8.5}}`},
+		{`{"genres": ["drama", "crime"]}`, `{"genres": []}`, `{"genres": []}`},
+		{`{"title": "Moana"}`, `{}`, `{"title": "Moana"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.doc+" + "+tt.patch, func(t *testing.T) {
+			got, err := Merge([]byte(tt.doc), []byte(tt.patch))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !jsonEqual(t, got, tt.want) {
+				t.Errorf("want %s; got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMergeInvalidJSON(t *testing.T) {
+	_, err := Merge([]byte(`{"a": "b"}`), []byte(`{"a":`))
+	if err == nil {
+		t.Error("want error for an invalid patch")
+	}
+
+	_, err = Merge([]byte(`{"a":`), []byte(`{"a": "b"}`))
+	if err == nil {
+		t.Error("want error for an invalid document")
+	}
+}
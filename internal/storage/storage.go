@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var ErrInvalidKey = errors.New("invalid storage key")
+
+// Storage 保存上传的二进制文件（例如影片海报）。key 是以 / 分隔的相对路径，例如 "posters/1/w342.jpg"，
+// 不同的实现可以把文件保存到本地磁盘、对象存储等地方，URL() 返回客户端可以直接访问的地址。
+type Storage interface {
+	Put(key string, r io.Reader, contentType string) error
+	Delete(key string) error
+	URL(key string) string
+}
+
+// Local 把文件保存在本地文件系统的 dir 目录下，并假设该目录通过 baseURL 对外提供访问。
+type Local struct {
+	dir     string
+	baseURL string
+}
+
+func NewLocal(dir, baseURL string) (*Local, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Local{dir: dir, baseURL: strings.TrimSuffix(baseURL, "/")}, nil
+}
+
+// Dir 返回保存文件的根目录，用于对外提供静态文件服务。
+func (l *Local) Dir() string {
+	return l.dir
+}
+
+// Put 先把内容写入同一目录下的临时文件，再重命名为目标文件，这样读取者永远不会看到只写了一半的文件。
+// 本地文件系统不保存 contentType，提供文件服务时会根据文件内容重新检测。
+func (l *Local) Put(key string, r io.Reader, contentType string) error {
+	name, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(name), 0o755)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, r)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), name)
+}
+
+// Delete 删除文件，文件不存在时不返回错误。
+func (l *Local) Delete(key string) error {
+	name, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(name)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (l *Local) URL(key string) string {
+	u := url.URL{Path: key}
+	return l.baseURL + "/" + u.EscapedPath()
+}
+
+// path() 把 key 转换为本地文件路径，并拒绝任何可能逃逸出 dir 目录的 key（例如包含 ".."）。
+func (l *Local) path(key string) (string, error) {
+	if key == "" || path.Clean(key) != key || strings.HasPrefix(key, "/") || strings.HasPrefix(key, "..") {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(l.dir, filepath.FromSlash(key)), nil
+}
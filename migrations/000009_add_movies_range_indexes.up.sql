@@ -0,0 +1,4 @@
+-- 列表查询只会涉及未删除的影片，因此使用部分索引。genres 上已有的 GIN 索引同时支持 @> 和 && 运算符。
+CREATE INDEX IF NOT EXISTS movies_year_idx ON movies (year) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS movies_run_time_idx ON movies (run_time) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS movies_created_at_idx ON movies (created_at) WHERE deleted_at IS NULL;
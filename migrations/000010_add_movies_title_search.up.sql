@@ -0,0 +1,6 @@
+-- pg_trgm 提供 similarity() 函数和 % 运算符，用于容忍标题搜索中的拼写错误。
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS movies_title_trgm_idx ON movies USING GIN (title gin_trgm_ops);
+-- simple 配置的全文搜索索引已经在 000003 中创建，这里为最常用的 english 配置补充一个索引。
+CREATE INDEX IF NOT EXISTS movies_title_english_idx ON movies USING GIN (to_tsvector('english', title));
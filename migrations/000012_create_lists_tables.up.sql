@@ -0,0 +1,23 @@
+-- kind 为 watchlist 或 favourites 的列表每个用户只能有一个，custom 列表可以有任意多个，但名称不能重复。
+CREATE TABLE IF NOT EXISTS lists (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    name text NOT NULL,
+    kind text NOT NULL DEFAULT 'custom' CHECK (kind IN ('watchlist', 'favourites', 'custom')),
+    public boolean NOT NULL DEFAULT false,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    version integer NOT NULL DEFAULT 1,
+    CONSTRAINT lists_user_id_name_key UNIQUE (user_id, name)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS lists_user_id_kind_key ON lists (user_id, kind) WHERE kind <> 'custom';
+
+-- 同一部影片在一个列表中只能出现一次，position 决定影片在列表中的顺序。
+CREATE TABLE IF NOT EXISTS list_items (
+    list_id bigint NOT NULL REFERENCES lists ON DELETE CASCADE,
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    position integer NOT NULL,
+    added_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (list_id, movie_id)
+);
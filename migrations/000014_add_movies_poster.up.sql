@@ -0,0 +1,2 @@
+-- poster 保存海报原图及缩略图的地址和尺寸，没有海报的影片为 NULL。
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS poster jsonb;
@@ -0,0 +1,86 @@
+-- genre_slug() 把任意的类型名称转换为 slug：转为小写，连续的分隔字符替换为一个 "-"，并去掉首尾的 "-"。
+-- 例如 "Sci-Fi" 和 " sci fi " 都会得到 "sci-fi"，"Ciencia Ficción" 会得到 "ciencia-ficción"。
+-- [:alnum:] 等字符类的含义取决于数据库的 locale，所以这里明确列出分隔字符：ASCII 中除字母和数字以外的字符、Latin-1 中的标点和符号、
+-- Unicode 通用标点以及全角空格和中日文标点。其他字符（包括所有语言的字母和数字）都会保留，所以非 ASCII 的类型名称不会变成空的 slug。
+-- 它只在这个迁移中用于整理已有的数据。应用程序中的 data.GenreSlug() 把所有非字母数字的字符都当作分隔字符，
+-- 对于由字母、数字和常见标点组成的名称两者的结果相同，但对于 emoji、™ 这类较少见的符号，两者的结果可能不同。
+CREATE OR REPLACE FUNCTION genre_slug(name text) RETURNS text AS $$
+    SELECT trim(both '-' from regexp_replace(lower(name), '[\u0001-\u002f\u003a-\u0040\u005b-\u0060\u007b-\u00a9\u00ab-\u00b1\u00b4\u00b6-\u00b8\u00bb\u00bf\u00d7\u00f7\u2000-\u206f\u3000-\u3003]+', '-', 'g'))
+$$ LANGUAGE SQL IMMUTABLE;
+
+-- movies.genres 中保存的是 slug。aliases 中的 slug 在校验影片时会被规范化为该类型的 slug。
+CREATE TABLE IF NOT EXISTS genres (
+    id bigserial PRIMARY KEY,
+    slug text NOT NULL UNIQUE,
+    name text NOT NULL,
+    aliases text[] NOT NULL DEFAULT '{}',
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO genres (slug, name, aliases)
+VALUES
+    ('action', 'Action', '{}'),
+    ('adventure', 'Adventure', '{}'),
+    ('animation', 'Animation', '{animated}'),
+    ('comedy', 'Comedy', '{}'),
+    ('crime', 'Crime', '{}'),
+    ('documentary', 'Documentary', '{}'),
+    ('drama', 'Drama', '{}'),
+    ('family', 'Family', '{}'),
+    ('fantasy', 'Fantasy', '{}'),
+    ('history', 'History', '{historical}'),
+    ('horror', 'Horror', '{}'),
+    ('music', 'Music', '{musical}'),
+    ('mystery', 'Mystery', '{}'),
+    ('romance', 'Romance', '{}'),
+    ('sci-fi', 'Sci-Fi', '{science-fiction,scifi}'),
+    ('thriller', 'Thriller', '{}'),
+    ('war', 'War', '{}'),
+    ('western', 'Western', '{}')
+ON CONFLICT DO NOTHING;
+
+-- 已有影片中使用的其他类型也加入到类型表中，名称沿用第一次出现时的写法。
+INSERT INTO genres (slug, name)
+SELECT DISTINCT ON (genre_slug(u.name)) genre_slug(u.name), u.name
+FROM movies, unnest(movies.genres) AS u(name)
+WHERE genre_slug(u.name) <> ''
+AND NOT EXISTS (
+    SELECT 1 FROM genres
+    WHERE genres.slug = genre_slug(u.name) OR genre_slug(u.name) = ANY(genres.aliases)
+)
+ORDER BY genre_slug(u.name), u.name;
+
+-- 把已有影片中的类型规范化为 slug（保持原来的顺序并去掉重复），发生变化的影片版本号加一。无法转换为 slug 的值（例如只包含标点）
+-- 原样保留，不会被丢弃。与 MovieModel.Update() 一样，改写之前先补录影片的当前版本，改写之后再记录新版本，修改者未知。
+WITH normalized AS (
+    SELECT movies.id, ARRAY(
+        SELECT COALESCE(genres.slug, u.name)
+        FROM unnest(movies.genres) WITH ORDINALITY AS u(name, n)
+        LEFT JOIN genres ON genres.slug = genre_slug(u.name) OR genre_slug(u.name) = ANY(genres.aliases)
+        GROUP BY COALESCE(genres.slug, u.name)
+        ORDER BY min(u.n)
+    ) AS genres
+    FROM movies
+), changed AS (
+    SELECT movies.id, movies.version, movies.title, movies.year, movies.run_time, movies.genres, movies.created_at,
+           normalized.genres AS normalized_genres
+    FROM movies
+    INNER JOIN normalized ON normalized.id = movies.id
+    WHERE movies.genres <> normalized.genres
+), backfilled AS (
+    INSERT INTO movie_revisions (movie_id, version, title, year, run_time, genres, created_at)
+    SELECT id, version, title, year, run_time, genres, created_at FROM changed
+    ON CONFLICT DO NOTHING
+), updated AS (
+    UPDATE movies
+    SET genres = changed.normalized_genres, version = movies.version + 1
+    FROM changed
+    WHERE movies.id = changed.id
+    RETURNING movies.id, movies.version, movies.title, movies.year, movies.run_time, movies.genres
+)
+INSERT INTO movie_revisions (movie_id, version, title, year, run_time, genres)
+SELECT id, version, title, year, run_time, genres FROM updated
+ON CONFLICT DO NOTHING;
+
+INSERT INTO permissions (code)
+VALUES ('genres:write');
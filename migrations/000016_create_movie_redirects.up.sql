@@ -0,0 +1,8 @@
+-- 影片被合并到另一部影片之后，原来的 ID 保留为指向保留影片的重定向。保留影片被彻底删除时重定向也随之删除。
+CREATE TABLE IF NOT EXISTS movie_redirects (
+    movie_id bigint PRIMARY KEY,
+    target_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS movie_redirects_target_id_idx ON movie_redirects (target_id);